@@ -32,6 +32,26 @@ func StartServer(kernel *kernel.Kernel, listenAddress string) (server *Server) {
 		v1.GET(protocol.HealthPath, server.builtinService.health)
 		v1.POST(protocol.AddJobPath, server.builtinService.addJob)
 		v1.POST(protocol.RemoveJobPath, server.builtinService.removeJob)
+		v1.GET(protocol.StatusPath, server.builtinService.status)
+		v1.GET(protocol.JobsPath, server.builtinService.getJobs)
+		v1.GET(protocol.JobsPath+":id", server.builtinService.getJob)
+		v1.GET(protocol.JobsPath+":id"+protocol.StatusPath, server.builtinService.getJobStatus)
+		v1.POST(protocol.JobsPath+":id"+protocol.PausePath, server.builtinService.pauseJob)
+		v1.POST(protocol.JobsPath+":id"+protocol.ResumePath, server.builtinService.resumeJob)
+		v1.POST(protocol.JobsPath, server.builtinService.createJob)
+		v1.PUT(protocol.JobsPath+":id", server.builtinService.updateJob)
+		v1.POST(protocol.DrainPath, server.builtinService.drain)
+		v1.GET(protocol.LoadsPath, server.builtinService.loads)
+		v1.GET(protocol.RebalancePlanPath, server.builtinService.planRebalance)
+		v1.POST(protocol.RebalanceApplyPath, server.builtinService.applyPlan)
+		v1.POST(protocol.RebalancePath, server.builtinService.rebalance)
+		v1.GET(protocol.CordonPath, server.builtinService.getCordons)
+		v1.PUT(protocol.CordonPath+":id", server.builtinService.cordon)
+		v1.DELETE(protocol.CordonPath+":id", server.builtinService.uncordon)
+		v1.GET(protocol.PlacementPath+":id", server.builtinService.getPlacement)
+		v1.PUT(protocol.PlacementPath+":id", server.builtinService.setPlacement)
+		v1.PUT(protocol.PinPath+":id/:member", server.builtinService.pinJob)
+		v1.DELETE(protocol.PinPath+":id", server.builtinService.unpinJob)
 	}
 
 	go func() {
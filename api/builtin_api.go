@@ -4,12 +4,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rhizomata/bridge-chain-etcd/kernel"
 	"github.com/rhizomata/bridge-chain-etcd/kernel/job"
+	"github.com/rhizomata/bridge-chain-etcd/kernel/worker"
+	"github.com/rhizomata/bridge-chain-etcd/protocol"
 )
 
+// drainTimeout how long drain waits for workers to stop
+const drainTimeout = time.Minute
+
 // BuiltinService ..
 type BuiltinService struct {
 	kernel *kernel.Kernel
@@ -18,6 +25,12 @@ type BuiltinService struct {
 func (service BuiltinService) health(context *gin.Context) {
 	checkFrom := context.GetHeader("Check-From")
 	fmt.Println("checkFrom : ", checkFrom)
+	if state, _ := service.kernel.State(); state == kernel.StateDisconnected {
+		context.Status(http.StatusServiceUnavailable)
+		context.Writer.WriteString(state.String())
+		context.Writer.Flush()
+		return
+	}
 	context.Writer.WriteString("OK")
 	context.Writer.Flush()
 }
@@ -31,8 +44,19 @@ func (service BuiltinService) addJob(context *gin.Context) {
 		return
 	}
 
-	job := service.kernel.GetJobManager().AddJob(job.NewJob(data))
-	data, err = json.Marshal(job)
+	if !service.validateJob(context, data) {
+		return
+	}
+
+	newJob := job.NewJob(data)
+	err = service.kernel.GetJobManager().AddJob(newJob)
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	data, err = json.Marshal(newJob)
 	if err != nil {
 		context.Status(http.StatusInternalServerError)
 		context.Writer.WriteString(err.Error())
@@ -62,3 +86,366 @@ func (service BuiltinService) removeJob(context *gin.Context) {
 	context.Writer.WriteString("ok")
 	context.Writer.Flush()
 }
+
+func (service BuiltinService) drain(context *gin.Context) {
+	err := service.kernel.Drain(drainTimeout)
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.Writer.WriteString("ok")
+	context.Writer.Flush()
+}
+
+func (service BuiltinService) getPlacement(context *gin.Context) {
+	placement, err := service.kernel.GetJobManager().GetPlacement(context.Param("id"))
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	if placement == nil {
+		context.Status(http.StatusNotFound)
+		return
+	}
+	context.JSON(http.StatusOK, placement)
+}
+
+func (service BuiltinService) setPlacement(context *gin.Context) {
+	placement := new(job.Placement)
+	err := context.BindJSON(placement)
+	if err != nil {
+		return
+	}
+
+	_, err = service.kernel.GetJobManager().GetJob(context.Param("id"))
+	if err != nil {
+		context.Status(http.StatusNotFound)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+
+	err = service.kernel.GetJobManager().SetPlacement(context.Param("id"), placement)
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.Writer.WriteString("ok")
+	context.Writer.Flush()
+}
+
+func (service BuiltinService) pinJob(context *gin.Context) {
+	service.setPin(context, context.Param("member"))
+}
+
+func (service BuiltinService) unpinJob(context *gin.Context) {
+	service.setPin(context, "")
+}
+
+func (service BuiltinService) setPin(context *gin.Context, membID string) {
+	_, err := service.kernel.GetJobManager().GetJob(context.Param("id"))
+	if err != nil {
+		context.Status(http.StatusNotFound)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+
+	err = service.kernel.GetJobManager().PinJob(context.Param("id"), membID)
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.Writer.WriteString("ok")
+	context.Writer.Flush()
+}
+
+func (service BuiltinService) loads(context *gin.Context) {
+	loads, err := service.kernel.MemberLoads()
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.JSON(http.StatusOK, loads)
+}
+
+func (service BuiltinService) planRebalance(context *gin.Context) {
+	plan, err := service.kernel.PlanRebalance(context.Query("full") == "true")
+	if err != nil {
+		writeRebalanceError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, plan)
+}
+
+func (service BuiltinService) applyPlan(context *gin.Context) {
+	plan := new(job.Plan)
+	err := context.BindJSON(plan)
+	if err != nil {
+		return
+	}
+
+	err = service.kernel.ApplyPlan(plan)
+	if err != nil {
+		writeRebalanceError(context, err)
+		return
+	}
+	context.Writer.WriteString("ok")
+	context.Writer.Flush()
+}
+
+func (service BuiltinService) rebalance(context *gin.Context) {
+	plan, err := service.kernel.Rebalance(context.Query("full") == "true")
+	if err != nil {
+		writeRebalanceError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, plan)
+}
+
+// writeRebalanceError : plans are applied only by the leader on current member jobs
+func writeRebalanceError(context *gin.Context, err error) {
+	if err == job.ErrNotLeader || err == job.ErrStalePlan || err == job.ErrInvalidPlan {
+		context.Status(http.StatusConflict)
+	} else {
+		context.Status(http.StatusInternalServerError)
+	}
+	context.Writer.WriteString(err.Error())
+	context.Writer.Flush()
+}
+
+func (service BuiltinService) getCordons(context *gin.Context) {
+	ids, err := service.kernel.GetClusterManager().GetCordons()
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.JSON(http.StatusOK, ids)
+}
+
+func (service BuiltinService) cordon(context *gin.Context) {
+	err := service.kernel.GetClusterManager().Cordon(context.Param("id"))
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.Writer.WriteString("ok")
+	context.Writer.Flush()
+}
+
+func (service BuiltinService) uncordon(context *gin.Context) {
+	err := service.kernel.GetClusterManager().Uncordon(context.Param("id"))
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.Writer.WriteString("ok")
+	context.Writer.Flush()
+}
+
+func (service BuiltinService) getJobs(context *gin.Context) {
+	jobs, err := service.kernel.GetJobManager().GetAllJobs()
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+
+	statuses, err := service.kernel.JobStatuses()
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+
+	state := context.Query("state")
+	list := []protocol.Job{}
+	for id, j := range jobs {
+		status, ok := statuses[id]
+		if state != "" && (!ok || status.State != state) {
+			continue
+		}
+		pj := toProtocolJob(j)
+		if ok {
+			pj.Status = toProtocolJobStatus(status)
+		}
+		list = append(list, pj)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	context.JSON(http.StatusOK, list)
+}
+
+func (service BuiltinService) getJob(context *gin.Context) {
+	j, err := service.kernel.GetJobManager().GetJob(context.Param("id"))
+	if err != nil {
+		context.Status(http.StatusNotFound)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	pj := toProtocolJob(j)
+	status, err := service.kernel.JobStatus(j.ID)
+	if err == nil {
+		pj.Status = toProtocolJobStatus(status)
+	}
+	context.JSON(http.StatusOK, pj)
+}
+
+func (service BuiltinService) getJobStatus(context *gin.Context) {
+	status, err := service.kernel.JobStatus(context.Param("id"))
+	if err != nil {
+		context.Status(http.StatusNotFound)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.JSON(http.StatusOK, toProtocolJobStatus(status))
+}
+
+func (service BuiltinService) createJob(context *gin.Context) {
+	spec := new(protocol.Job)
+	err := context.BindJSON(spec)
+	if err != nil {
+		return
+	}
+
+	if !service.validateJob(context, []byte(spec.Data)) {
+		return
+	}
+
+	newJob := job.NewJob([]byte(spec.Data))
+	newJob.Name = spec.Name
+	newJob.Labels = spec.Labels
+	newJob.Creator = spec.Creator
+	if spec.Placement != nil {
+		newJob.Placement = &job.Placement{RequiredLabels: spec.Placement.RequiredLabels,
+			AntiAffinity: spec.Placement.AntiAffinity, PreferredZone: spec.Placement.PreferredZone,
+			PinnedTo: spec.Placement.PinnedTo}
+	}
+
+	err = service.kernel.GetJobManager().AddJob(newJob)
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+
+	created, err := service.kernel.GetJobManager().GetJob(newJob.ID)
+	if err != nil {
+		context.Status(http.StatusInternalServerError)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+	context.JSON(http.StatusOK, toProtocolJob(created))
+}
+
+func (service BuiltinService) updateJob(context *gin.Context) {
+	spec := new(protocol.Job)
+	err := context.BindJSON(spec)
+	if err != nil {
+		return
+	}
+
+	_, err = service.kernel.GetJobManager().GetJob(context.Param("id"))
+	if err != nil {
+		context.Status(http.StatusNotFound)
+		context.Writer.WriteString(err.Error())
+		context.Writer.Flush()
+		return
+	}
+
+	if !service.validateJob(context, []byte(spec.Data)) {
+		return
+	}
+
+	_, err = service.kernel.GetJobManager().UpdateJob(job.Job{ID: context.Param("id"), Data: []byte(spec.Data),
+		Name: spec.Name, Labels: spec.Labels})
+	service.writeJobResult(context, err)
+}
+
+func (service BuiltinService) pauseJob(context *gin.Context) {
+	service.writeJobResult(context, service.kernel.GetJobManager().PauseJob(context.Param("id")))
+}
+
+func (service BuiltinService) resumeJob(context *gin.Context) {
+	service.writeJobResult(context, service.kernel.GetJobManager().ResumeJob(context.Param("id")))
+}
+
+// writeJobResult writes the job changed by the request, or the error
+func (service BuiltinService) writeJobResult(context *gin.Context, err error) {
+	if err == nil {
+		var j job.Job
+		j, err = service.kernel.GetJobManager().GetJob(context.Param("id"))
+		if err == nil {
+			context.JSON(http.StatusOK, toProtocolJob(j))
+			return
+		}
+	}
+	if err == job.ErrJobChanged {
+		context.Status(http.StatusConflict)
+	} else {
+		context.Status(http.StatusInternalServerError)
+	}
+	context.Writer.WriteString(err.Error())
+	context.Writer.Flush()
+}
+
+// validateJob writes 400 with protocol.ValidationError if data is invalid
+func (service BuiltinService) validateJob(context *gin.Context, data []byte) bool {
+	err := service.kernel.ValidateJob(data)
+	if err == nil {
+		return true
+	}
+	validationErr, ok := err.(*worker.ValidationError)
+	if !ok {
+		validationErr = &worker.ValidationError{Message: err.Error()}
+	}
+	context.JSON(http.StatusBadRequest, protocol.ValidationError{Factory: validationErr.Factory,
+		Field: validationErr.Field, Message: validationErr.Message})
+	return false
+}
+
+func toProtocolJob(j job.Job) protocol.Job {
+	pj := protocol.Job{ID: j.ID, Name: j.Name, Labels: j.Labels, CreatedAt: j.CreatedAt, UpdatedAt: j.UpdatedAt,
+		Creator: j.Creator, Version: j.Version, Paused: j.Paused, Data: string(j.Data)}
+	if j.Placement != nil {
+		pj.Placement = &protocol.Placement{RequiredLabels: j.Placement.RequiredLabels,
+			AntiAffinity: j.Placement.AntiAffinity, PreferredZone: j.Placement.PreferredZone,
+			PinnedTo: j.Placement.PinnedTo}
+	}
+	return pj
+}
+
+func toProtocolJobStatus(status worker.JobStatus) *protocol.JobStatus {
+	return &protocol.JobStatus{State: status.State, Error: status.Error, Owner: status.Owner,
+		StartedAt: status.StartedAt, RestartCount: status.RestartCount, UpdatedAt: status.UpdatedAt}
+}
+
+func (service BuiltinService) status(context *gin.Context) {
+	context.JSON(http.StatusOK, service.kernel.Status())
+}
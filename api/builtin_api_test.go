@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rhizomata/bridge-chain-etcd/kernel"
+	"github.com/rhizomata/bridge-chain-etcd/kernel/job"
+	"github.com/rhizomata/bridge-chain-etcd/kernel/model"
+	"github.com/rhizomata/bridge-chain-etcd/kernel/worker"
+	"github.com/rhizomata/bridge-chain-etcd/protocol"
+)
+
+// newTestRouter routes builtin service of a kernel on in-memory KV, which is not started.
+// stop must be called at the end of the test.
+func newTestRouter(t *testing.T) (router *gin.Engine, k *kernel.Kernel, stop func()) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err = kernel.New(&model.Config{Cluster: "c1", Name: "n1", DataDir: dir, InMemoryKV: true})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	stop = func() {
+		k.Stop()
+		os.RemoveAll(dir)
+	}
+
+	gin.SetMode(gin.TestMode)
+	service := &BuiltinService{kernel: k}
+	router = gin.New()
+	v1 := router.Group(protocol.V1Path)
+	v1.POST(protocol.AddJobPath, service.addJob)
+	v1.PUT(protocol.PlacementPath+":id", service.setPlacement)
+	v1.PUT(protocol.PinPath+":id/:member", service.pinJob)
+	v1.DELETE(protocol.PinPath+":id", service.unpinJob)
+	return router, k, stop
+}
+
+func serve(router *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, protocol.V1Path+path, strings.NewReader(body))
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestSetPlacementOfMissingJob(t *testing.T) {
+	router, k, stop := newTestRouter(t)
+	defer stop()
+
+	response := serve(router, http.MethodPut, protocol.PlacementPath+"none", `{"pinnedTo":"n1"}`)
+	if response.Code != http.StatusNotFound {
+		t.Fatal("placement of missing job", response.Code, response.Body.String())
+	}
+	if placement, _ := k.GetJobManager().GetPlacement("none"); placement != nil {
+		t.Fatal("placement of missing job is written", placement)
+	}
+}
+
+func TestPinJob(t *testing.T) {
+	router, k, stop := newTestRouter(t)
+	defer stop()
+
+	if response := serve(router, http.MethodPut, protocol.PinPath+"none/n1", ""); response.Code != http.StatusNotFound {
+		t.Fatal("pin of missing job", response.Code, response.Body.String())
+	}
+
+	newJob := job.NewJob([]byte("{}"))
+	newJob.Placement = &job.Placement{PreferredZone: "z1"}
+	if err := k.GetJobManager().AddJob(newJob); err != nil {
+		t.Fatal(err)
+	}
+	if response := serve(router, http.MethodPut, protocol.PinPath+newJob.ID+"/n1", ""); response.Code != http.StatusOK {
+		t.Fatal("pin", response.Code, response.Body.String())
+	}
+	placement, _ := k.GetJobManager().GetPlacement(newJob.ID)
+	if placement == nil || placement.PinnedTo != "n1" || placement.PreferredZone != "z1" {
+		t.Fatal("pin must be merged into the placement", placement)
+	}
+
+	response := serve(router, http.MethodPut, protocol.PlacementPath+newJob.ID, `{"preferredZone":"z2"}`)
+	if response.Code != http.StatusOK {
+		t.Fatal("placement", response.Code, response.Body.String())
+	}
+	placement, _ = k.GetJobManager().GetPlacement(newJob.ID)
+	if placement == nil || placement.PinnedTo != "n1" || placement.PreferredZone != "z2" {
+		t.Fatal("placement must keep the pin", placement)
+	}
+
+	if response = serve(router, http.MethodDelete, protocol.PinPath+newJob.ID, ""); response.Code != http.StatusOK {
+		t.Fatal("unpin", response.Code, response.Body.String())
+	}
+	placement, _ = k.GetJobManager().GetPlacement(newJob.ID)
+	if placement == nil || placement.PinnedTo != "" || placement.PreferredZone != "z2" {
+		t.Fatal("unpin must keep the placement", placement)
+	}
+}
+
+// validatingFactory accepts only job data "ok"
+type validatingFactory struct{}
+
+func (factory *validatingFactory) Name() string { return "v" }
+func (factory *validatingFactory) NewWorker(helper *worker.Helper) (worker.Worker, error) {
+	return nil, errors.New("not started in tests")
+}
+func (factory *validatingFactory) Validate(job []byte) error {
+	if string(job) != "ok" {
+		return &worker.ValidationError{Field: "data", Message: "not ok"}
+	}
+	return nil
+}
+
+func TestAddInvalidJob(t *testing.T) {
+	router, k, stop := newTestRouter(t)
+	defer stop()
+	k.RegisterWorkerFactory(&validatingFactory{})
+
+	for data, factory := range map[string]string{"#v:bad": "v", "#none:ok": "_root"} {
+		response := serve(router, http.MethodPost, protocol.AddJobPath, data)
+		if response.Code != http.StatusBadRequest {
+			t.Fatal("invalid job", data, response.Code, response.Body.String())
+		}
+		validationErr := protocol.ValidationError{}
+		if err := json.Unmarshal(response.Body.Bytes(), &validationErr); err != nil || validationErr.Factory != factory {
+			t.Fatal("invalid job must be rejected with a structured error", data, response.Body.String())
+		}
+	}
+	if jobs, _ := k.GetJobManager().GetAllJobs(); len(jobs) != 0 {
+		t.Fatal("invalid jobs are stored", jobs)
+	}
+
+	if response := serve(router, http.MethodPost, protocol.AddJobPath, "#v:ok"); response.Code != http.StatusOK {
+		t.Fatal("valid job", response.Code, response.Body.String())
+	}
+}
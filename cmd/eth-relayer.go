@@ -17,7 +17,10 @@ func main() {
 	daemonConfig := model.ParseFlagConfig()
 	daemonAddr := daemonConfig.GetDaemonAddr()
 
-	kernel := kernel.New(daemonConfig)
+	kernel, err := kernel.New(daemonConfig)
+	if err != nil {
+		log.Fatal("[ERROR] Cannot Create Kernel", err)
+	}
 
 	// "wss://mainnet.infura.io/ws"
 	tokenSubsMan := ethereum.NewEthSubsManager("wss://mainnet.infura.io/ws")
@@ -31,7 +34,11 @@ func main() {
 	kernel.RegisterWorkerFactory(tokenSubsMan)
 	kernel.RegisterWorkerFactory(multiFactory)
 
-	kernel.SetJobOrganizer(job.NewSimpleOrganizer())
+	organizer, err := job.NewOrganizer(daemonConfig.JobOrganizer)
+	if err != nil {
+		log.Fatal("[ERROR] Cannot Create Job Organizer", err)
+	}
+	kernel.SetJobOrganizer(organizer)
 
 	kernel.GetClusterManager().SetHealthCheckDelegator(func(memb *cluster.Member) bool {
 		return protocol.CheckHealth(memb.DaemonURL)
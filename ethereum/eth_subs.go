@@ -109,6 +109,42 @@ func (manager *EthSubsManager) NewWorker(helper *worker.Helper) (wroker worker.W
 	return &subscriber, nil
 }
 
+// Weight implements worker.Weigher. A job weighs the number of contracts it watches.
+func (manager *EthSubsManager) Weight(job []byte) (weight int, err error) {
+	jobInfo := new(EthSubsJobInfo)
+	err = json.Unmarshal(job, jobInfo)
+	if err != nil {
+		return 1, err
+	}
+	if len(jobInfo.CAs) == 0 {
+		return 1, nil
+	}
+	return len(jobInfo.CAs), nil
+}
+
+// Validate implements worker.Validator. A job must name a registered log handler and valid contract addresses.
+func (manager *EthSubsManager) Validate(job []byte) error {
+	jobInfo := new(EthSubsJobInfo)
+	err := json.Unmarshal(job, jobInfo)
+	if err != nil {
+		return &worker.ValidationError{Factory: manager.Name(), Message: err.Error()}
+	}
+	if manager.handlers[jobInfo.Handler] == nil {
+		return &worker.ValidationError{Factory: manager.Name(), Field: "handler",
+			Message: "Unknown Log Handler " + jobInfo.Handler}
+	}
+	if len(jobInfo.CAs) == 0 {
+		return &worker.ValidationError{Factory: manager.Name(), Field: "cas", Message: "No contract address"}
+	}
+	for _, ca := range jobInfo.CAs {
+		if !common.IsHexAddress(ca) {
+			return &worker.ValidationError{Factory: manager.Name(), Field: "cas",
+				Message: "Invalid contract address " + ca}
+		}
+	}
+	return nil
+}
+
 //ID ..
 func (subscriber *EthSubscriber) ID() string {
 	return subscriber.id
@@ -0,0 +1,29 @@
+package ethereum
+
+import (
+	"testing"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/worker"
+)
+
+func TestEthSubsValidate(t *testing.T) {
+	manager := NewEthSubsManager("wss://localhost")
+
+	valid := `{"handler":"erc20","cas":["0xdAC17F958D2ee523a2206206994597C13D831ec7"]}`
+	if err := manager.Validate([]byte(valid)); err != nil {
+		t.Fatal("valid job is rejected", err)
+	}
+
+	invalid := map[string]string{
+		`{"handler":`: "",
+		`{"handler":"none","cas":["0xdAC17F958D2ee523a2206206994597C13D831ec7"]}`: "handler",
+		`{"handler":"erc20"}`:                 "cas",
+		`{"handler":"erc20","cas":["0x123"]}`: "cas",
+	}
+	for data, field := range invalid {
+		validationErr, ok := manager.Validate([]byte(data)).(*worker.ValidationError)
+		if !ok || validationErr.Factory != "eth_subs" || validationErr.Field != field {
+			t.Fatal("invalid job must be rejected", data, validationErr)
+		}
+	}
+}
@@ -2,15 +2,19 @@ package cluster
 
 import (
 	"sort"
+	"sync"
 )
 
 // Cluster ..
 type Cluster struct {
+	mutex       sync.RWMutex
 	name        string
 	membIDs     []string
 	members     map[string]*Member
 	localMember *Member
 	leader      *Member
+	// term of leader, create revision of its election key. It only increases.
+	term int64
 }
 
 func newCluster(name string) *Cluster {
@@ -27,6 +31,9 @@ func (cluster *Cluster) Name() string {
 }
 
 func (cluster *Cluster) putMember(memb *Member) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+
 	if _, ok := cluster.members[memb.ID]; !ok {
 		cluster.membIDs = append(cluster.membIDs, memb.ID)
 		sort.Strings(cluster.membIDs)
@@ -36,6 +43,9 @@ func (cluster *Cluster) putMember(memb *Member) {
 }
 
 func (cluster *Cluster) removeMember(id string) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+
 	index := -1
 	for i, mid := range cluster.membIDs {
 		if mid == id {
@@ -54,19 +64,44 @@ func (cluster *Cluster) removeMember(id string) {
 	delete(cluster.members, id)
 }
 
+// setMemberMetadata copies draining and placement metadata of info to memb
+func (cluster *Cluster) setMemberMetadata(memb *Member, info Member) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+	memb.setMetadata(info)
+}
+
+// setDraining ..
+func (cluster *Cluster) setDraining(memb *Member, draining bool) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+	memb.Draining = draining
+}
+
 // GetMember get member with given name
 func (cluster *Cluster) GetMember(id string) *Member {
+	cluster.mutex.RLock()
+	defer cluster.mutex.RUnlock()
+
 	memb := cluster.members[id]
 	return memb
 }
 
 // GetSortedMembers get all member ids
 func (cluster *Cluster) GetSortedMembers() []string {
-	return cluster.membIDs
+	cluster.mutex.RLock()
+	defer cluster.mutex.RUnlock()
+
+	ids := make([]string, len(cluster.membIDs))
+	copy(ids, cluster.membIDs)
+	return ids
 }
 
 // GetAliveMembers get active members
 func (cluster *Cluster) GetAliveMembers() []*Member {
+	cluster.mutex.RLock()
+	defer cluster.mutex.RUnlock()
+
 	membs := []*Member{}
 	for _, memb := range cluster.members {
 		if memb.IsAlive() {
@@ -78,6 +113,9 @@ func (cluster *Cluster) GetAliveMembers() []*Member {
 
 // GetAliveMemberIDs get active member IDs
 func (cluster *Cluster) GetAliveMemberIDs() []string {
+	cluster.mutex.RLock()
+	defer cluster.mutex.RUnlock()
+
 	membs := []string{}
 	for id, memb := range cluster.members {
 		if memb.IsAlive() {
@@ -87,11 +125,55 @@ func (cluster *Cluster) GetAliveMemberIDs() []string {
 	return membs
 }
 
+// GetActiveMemberIDs get IDs of alive members which are not draining
+func (cluster *Cluster) GetActiveMemberIDs() []string {
+	cluster.mutex.RLock()
+	defer cluster.mutex.RUnlock()
+
+	membs := []string{}
+	for id, memb := range cluster.members {
+		if memb.IsAlive() && !memb.Draining {
+			membs = append(membs, id)
+		}
+	}
+	return membs
+}
+
 // Leader get Leader
 func (cluster *Cluster) Leader() *Member {
+	cluster.mutex.RLock()
+	defer cluster.mutex.RUnlock()
 	return cluster.leader
 }
 
+// Term get term of leader. A new leader always has a greater term.
+func (cluster *Cluster) Term() int64 {
+	cluster.mutex.RLock()
+	defer cluster.mutex.RUnlock()
+	return cluster.term
+}
+
+// setLeader sets leader of term, and flags of the previous and new leader members
+func (cluster *Cluster) setLeader(leader *Member, term int64) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+	if cluster.leader != nil {
+		cluster.leader.setLeader(false)
+	}
+	if leader != nil {
+		leader.setLeader(true)
+	}
+	cluster.leader = leader
+	cluster.term = term
+}
+
+// isLeader returns whether memb is leader, while the leader changes
+func (cluster *Cluster) isLeader(memb *Member) bool {
+	cluster.mutex.RLock()
+	defer cluster.mutex.RUnlock()
+	return memb.IsLeader()
+}
+
 // Local get localMember
 func (cluster *Cluster) Local() *Member {
 	return cluster.localMember
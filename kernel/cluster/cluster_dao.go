@@ -1,47 +1,77 @@
 package cluster
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
 )
 
 const (
-	kvDirSys                 = "/$sys/"
-	kvDirClusters            = kvDirSys + "clstrs/"
-	kvPatterMemberInfo       = kvDirClusters + "%s/memb/%s"
-	kvDirMemberHeartbeat     = kvDirSys + "%s/hb/"
-	kvPatternMemberHeartbeat = kvDirMemberHeartbeat + "%s"
-	kvPatternLeader          = kvDirClusters + "%s/leader"
+	kvDirSys              = "/$sys/"
+	kvDirClusters         = kvDirSys + "clstrs/"
+	kvPatternClusterDir   = kvDirClusters + "%s/"
+	kvPatternHeartbeatDir = kvDirSys + "%s/hb/"
+	kvDirMemberInfo       = "memb/"
+	kvPatternMemberInfo   = kvDirMemberInfo + "%s"
+	kvKeyLeader           = "leader"
+	kvKeyElection         = "election"
+	kvDirCordon           = "cordon/"
+	kvPatternCordon       = kvDirCordon + "%s"
+	kvPatternMemberJob    = "membjob/%s"
 )
 
+// ErrNotLeader returned when records of members are removed by a member which is not the leader
+var ErrNotLeader = errors.New("Members can only be removed by the leader")
+
 // DAO kv store model for cluster
 type DAO struct {
 	cluster string
-	kv      kv.KV
+	// store whole kv store, for transactions across cluster and heartbeat directories
+	store kv.KV
+	// kv view of the cluster directory
+	kv kv.KV
+	// hbKV view of the heartbeat directory
+	hbKV kv.KV
+}
+
+// newDAO ..
+func newDAO(cluster string, store kv.KV) *DAO {
+	return &DAO{
+		cluster: cluster,
+		store:   store,
+		kv:      kv.NewNamespace(store, fmt.Sprintf(kvPatternClusterDir, cluster)),
+		hbKV:    kv.NewNamespace(store, fmt.Sprintf(kvPatternHeartbeatDir, cluster)),
+	}
 }
 
 // GetLeader get leader id
 func (dao *DAO) GetLeader() (leader string, err error) {
-	key := fmt.Sprintf(kvPatternLeader, dao.cluster)
-	bytes, err := dao.kv.GetOne(key)
+	bytes, err := dao.kv.GetOne(kvKeyLeader)
 	if err != nil {
 		return "", err
 	}
 	return string(bytes), nil
 }
 
-// PutLeader set leader
-func (dao *DAO) PutLeader(leader string) (err error) {
-	key := fmt.Sprintf(kvPatternLeader, dao.cluster)
-	_, err = dao.kv.Put(key, leader)
-	return err
+// PutLeader set leader only while the election key of leader is still created at term
+func (dao *DAO) PutLeader(electionKey string, term int64, leader string) (succeeded bool, err error) {
+	compare := kv.CreateRevisionEquals(electionKey, term)
+	succeeded, _, err = dao.kv.Txn([]kv.Compare{compare}, []kv.Op{kv.OpPut(kvKeyLeader, leader)})
+	return succeeded, err
+}
+
+// NewElection creates a leader election candidate with a session of ttl seconds
+func (dao *DAO) NewElection(ttl int64) (election kv.Election, err error) {
+	return dao.kv.NewElection(kvKeyElection, ttl)
 }
 
 // GetMemberInfo ..
 func (dao *DAO) GetMemberInfo(id string) (memb Member, err error) {
-	key := fmt.Sprintf(kvPatterMemberInfo, dao.cluster, id)
+	key := fmt.Sprintf(kvPatternMemberInfo, id)
 	memb = Member{ID: id}
 	// fmt.Println("********* Before GetMemberInfo:", key, memb)
 	err = dao.kv.GetObject(key, &memb)
@@ -50,15 +80,100 @@ func (dao *DAO) GetMemberInfo(id string) (memb Member, err error) {
 
 // PutMemberInfo ..
 func (dao *DAO) PutMemberInfo(memb Member) (err error) {
-	key := fmt.Sprintf(kvPatterMemberInfo, dao.cluster, memb.ID)
+	key := fmt.Sprintf(kvPatternMemberInfo, memb.ID)
 	_, err = dao.kv.PutObject(key, memb)
 	// fmt.Println("********* PutMemberInfo:", key, memb)
 	return err
 }
 
+// GetMemberIDs ..
+func (dao *DAO) GetMemberIDs() (ids []string, err error) {
+	ids = []string{}
+	err = dao.kv.GetWithPrefix(kvDirMemberInfo,
+		func(key string, value []byte) {
+			ids = append(ids, key[len(kvDirMemberInfo):])
+		})
+	return ids, err
+}
+
+// DeleteMember deletes heartbeat, info and job assignments of a member at once, only while the election key
+// of the leader is still created at term.
+func (dao *DAO) DeleteMember(leaderKey string, term int64, id string) (err error) {
+	if leaderKey == "" {
+		return ErrNotLeader
+	}
+	clusterDir := fmt.Sprintf(kvPatternClusterDir, dao.cluster)
+	compare := kv.CreateRevisionEquals(clusterDir+leaderKey, term)
+	ops := []kv.Op{
+		kv.OpDelete(fmt.Sprintf(kvPatternHeartbeatDir, dao.cluster) + id),
+		kv.OpDelete(clusterDir + fmt.Sprintf(kvPatternMemberInfo, id)),
+		kv.OpDelete(clusterDir + fmt.Sprintf(kvPatternMemberJob, id)),
+	}
+	succeeded, _, err := dao.store.Txn([]kv.Compare{compare}, ops)
+	if err == nil && !succeeded {
+		err = ErrNotLeader
+	}
+	return err
+}
+
+// DeleteMemberInfo ..
+func (dao *DAO) DeleteMemberInfo(id string) (err error) {
+	_, err = dao.kv.DeleteOne(fmt.Sprintf(kvPatternMemberInfo, id))
+	return err
+}
+
+// WatchMemberInfos .. handler is called when member info is written
+func (dao *DAO) WatchMemberInfos(handler func(memb Member)) (watcher *kv.Watcher) {
+	watcher = dao.kv.WatchEventsWithPrefix(kvDirMemberInfo,
+		func(event kv.Event) {
+			if event.Type != kv.EventPut {
+				return
+			}
+			memb := Member{}
+			err := json.Unmarshal(event.Value, &memb)
+			if err != nil {
+				log.Println("[ERROR-ClusterDao] unmarshal member info ", event.Key, err)
+				return
+			}
+			handler(memb)
+		})
+	return watcher
+}
+
+// GetCordons returns ids of cordoned members
+func (dao *DAO) GetCordons() (ids []string, err error) {
+	ids = []string{}
+	err = dao.kv.GetWithPrefix(kvDirCordon,
+		func(key string, value []byte) {
+			ids = append(ids, key[len(kvDirCordon):])
+		})
+	return ids, err
+}
+
+// PutCordon ..
+func (dao *DAO) PutCordon(id string) (err error) {
+	_, err = dao.kv.Put(fmt.Sprintf(kvPatternCordon, id), time.Now().Format(time.RFC3339))
+	return err
+}
+
+// DeleteCordon ..
+func (dao *DAO) DeleteCordon(id string) (err error) {
+	_, err = dao.kv.DeleteOne(fmt.Sprintf(kvPatternCordon, id))
+	return err
+}
+
+// WatchCordons .. handler is called when members are cordoned or uncordoned
+func (dao *DAO) WatchCordons(handler func(id string, cordoned bool)) (watcher *kv.Watcher) {
+	watcher = dao.kv.WatchEventsWithPrefix(kvDirCordon,
+		func(event kv.Event) {
+			handler(event.Key[len(kvDirCordon):], event.Type == kv.EventPut)
+		})
+	return watcher
+}
+
 // GetHeartbeat ..
 func (dao *DAO) GetHeartbeat(id string) (tm time.Time, err error) {
-	bytes, err := dao.kv.GetOne(fmt.Sprintf(kvPatternMemberHeartbeat, dao.cluster, id))
+	bytes, err := dao.hbKV.GetOne(id)
 	if err == nil {
 		tm, err = time.Parse(time.RFC3339, string(bytes))
 	}
@@ -67,14 +182,8 @@ func (dao *DAO) GetHeartbeat(id string) (tm time.Time, err error) {
 
 // GetHeartbeats  ..
 func (dao *DAO) GetHeartbeats(handler func(id string, tm time.Time)) (err error) {
-	dirPath := fmt.Sprintf(kvDirMemberHeartbeat, dao.cluster)
-
-	// fmt.Println("*********** GetHeartbeats : dirPath:", dirPath)
-	err = dao.kv.GetWithPrefix(dirPath,
-		func(key string, value []byte) {
-			a := []rune(key)
-			id := string(a[len(dirPath):])
-
+	err = dao.hbKV.GetWithPrefix("",
+		func(id string, value []byte) {
 			tm, err2 := time.Parse(time.RFC3339, string(value))
 			if err2 != nil {
 				// log.Println("[ERROR] Parse member Heartbeat time :", err2)
@@ -85,11 +194,49 @@ func (dao *DAO) GetHeartbeats(handler func(id string, tm time.Time)) (err error)
 	return err
 }
 
-// PutHeartbeat ..
-func (dao *DAO) PutHeartbeat(id string) (err error) {
-	key := fmt.Sprintf(kvPatternMemberHeartbeat, dao.cluster, id)
+// WatchHeartbeats .. tm is zero for deleted heartbeat
+func (dao *DAO) WatchHeartbeats(handler func(eventType kv.EventType, id string, tm time.Time)) (watcher *kv.Watcher) {
+	watcher = dao.hbKV.WatchEventsWithPrefix("",
+		func(event kv.Event) {
+			id := event.Key
+			if event.Type == kv.EventDelete {
+				handler(event.Type, id, time.Time{})
+				return
+			}
+
+			tm, err := time.Parse(time.RFC3339, string(event.Value))
+			if err == nil {
+				handler(event.Type, id, tm)
+			}
+		})
+	return watcher
+}
+
+// DeleteHeartbeat ..
+func (dao *DAO) DeleteHeartbeat(id string) (err error) {
+	_, err = dao.hbKV.DeleteOne(id)
+	return err
+}
+
+// PutHeartbeat .. If lease is not kv.NoLease, heartbeat is deleted when the lease expires.
+func (dao *DAO) PutHeartbeat(id string, lease kv.LeaseID) (err error) {
 	nowStr := time.Now().Format(time.RFC3339)
-	_, err = dao.kv.Put(key, nowStr)
+	_, err = dao.hbKV.PutWithLease(id, nowStr, lease)
 	// fmt.Println("********** PutHeartbeat:", key)
 	return err
 }
+
+// NewHeartbeatLease grants a heartbeat lease and keeps it alive
+func (dao *DAO) NewHeartbeatLease(ttl int64) (lease kv.LeaseID, err error) {
+	lease, err = dao.kv.GrantLease(ttl)
+	if err != nil {
+		return kv.NoLease, err
+	}
+	err = dao.kv.KeepAlive(lease)
+	return lease, err
+}
+
+// RevokeHeartbeatLease ..
+func (dao *DAO) RevokeHeartbeatLease(lease kv.LeaseID) (err error) {
+	return dao.kv.RevokeLease(lease)
+}
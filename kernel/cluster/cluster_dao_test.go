@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
+)
+
+func TestDeleteMember(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	dao := newDAO("c1", store)
+
+	election, err := dao.NewElection(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	term, err := election.Campaign(context.Background(), "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dao.PutHeartbeat("n2", kv.NoLease); err != nil {
+		t.Fatal(err)
+	}
+	if err = dao.PutMemberInfo(Member{ID: "n2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dao.kv.Put("membjob/n2", `{"term":1,"jobs":["j1"]}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dao.DeleteMember(election.Key(), term+1, "n2"); err != ErrNotLeader {
+		t.Fatal("stale term must not remove member", err)
+	}
+	if _, err = dao.GetMemberInfo("n2"); err != nil {
+		t.Fatal("member info removed by stale term", err)
+	}
+
+	if err = dao.DeleteMember(election.Key(), term, "n2"); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	if err = dao.GetHeartbeats(func(id string, tm time.Time) { ids = append(ids, id) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatal("heartbeat is not removed", ids)
+	}
+	if _, err = dao.GetMemberInfo("n2"); err == nil {
+		t.Fatal("member info is not removed")
+	}
+	if _, err = dao.kv.GetOne("membjob/n2"); err == nil {
+		t.Fatal("member jobs are not removed")
+	}
+}
@@ -1,8 +1,9 @@
 package cluster
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
@@ -11,25 +12,46 @@ import (
 
 // Manager cluster manager
 type Manager struct {
+	mutex                sync.Mutex
 	cluster              *Cluster
 	dao                  *DAO
 	config               model.Config
-	running              bool
 	memberChangeHandler  func(aliveMembers []string)
+	memberRemovedHandler func(id string)
 	healthCheckDelegator func(memb *Member) bool
+	lease                kv.LeaseID
+	heartbeatWatcher     *kv.Watcher
+	memberWatcher        *kv.Watcher
+	cordonWatcher        *kv.Watcher
+	// cordoned ids of cordoned members, including members not yet known
+	cordoned         map[string]bool
+	memberInfoStored bool
+	election         kv.Election
+	cancelCampaign   context.CancelFunc
+	leaderMutex      sync.RWMutex
+	// leaderKey election key of local member while it is the leader
+	leaderKey string
+	// deadSince time the leader found records of members without heartbeat
+	deadSince map[string]time.Time
+	// done is closed by Dispose to stop goroutines, and routines waits for them
+	done     chan struct{}
+	routines sync.WaitGroup
 }
 
 // NewManager create cluster
 func NewManager(localid string, config model.Config, kv kv.KV) *Manager {
 	cluster := newCluster(config.Cluster)
-	dao := DAO{cluster: config.Cluster, kv: kv}
+	dao := newDAO(config.Cluster, kv)
 
 	manager := new(Manager)
 	manager.cluster = cluster
-	manager.dao = &dao
+	manager.dao = dao
 	manager.config = config
+	manager.deadSince = make(map[string]time.Time)
+	manager.cordoned = make(map[string]bool)
 
-	localMemb := Member{Cluster: cluster.name, ID: localid, Name: config.Name, DaemonURL: config.GetDaemonURL()}
+	localMemb := Member{Cluster: cluster.name, ID: localid, Name: config.Name, DaemonURL: config.GetDaemonURL(),
+		Zone: config.Zone, Labels: config.Labels, Capacity: int(config.Capacity)}
 	localMemb.setLocal(true)
 	localMemb.setAlive(true)
 
@@ -46,6 +68,11 @@ func (manager *Manager) SetMemberChangeHandler(memberChangeHandler func(aliveMem
 	manager.memberChangeHandler = memberChangeHandler
 }
 
+// SetMemberRemovedHandler set handler called when the leader removes records of a dead member
+func (manager *Manager) SetMemberRemovedHandler(memberRemovedHandler func(id string)) {
+	manager.memberRemovedHandler = memberRemovedHandler
+}
+
 // SetHealthCheckDelegator ..
 func (manager *Manager) SetHealthCheckDelegator(healthCheckDelegator func(memb *Member) bool) {
 	manager.healthCheckDelegator = healthCheckDelegator
@@ -53,48 +80,364 @@ func (manager *Manager) SetHealthCheckDelegator(healthCheckDelegator func(memb *
 
 // Start start goroutins
 func (manager *Manager) Start() {
-	manager.running = true
+	manager.done = make(chan struct{})
 
-	err := manager.dao.PutMemberInfo(*manager.cluster.localMember)
-	if err != nil {
-		log.Fatal("[FATAL] Cannot send PutMemberInfo.", err)
-	}
-	err = manager.dao.PutHeartbeat(manager.cluster.localMember.ID)
-
-	if err != nil {
-		log.Fatal("[FATAL] Cannot send heartbeat.", err)
-	}
+	manager.sendHeartbeat()
 
+	manager.routines.Add(3)
 	go func() {
-		for manager.running {
-			time.Sleep(time.Duration(manager.config.HeartbeatInterval))
-			err := manager.dao.PutHeartbeat(manager.cluster.localMember.ID)
-			if err != nil {
-				log.Fatal("[FATAL] Cannot send heartbeat.", err)
-			}
+		defer manager.routines.Done()
+		for manager.sleep(time.Duration(manager.config.HeartbeatInterval)) {
+			manager.sendHeartbeat()
 		}
 	}()
 
+	manager.heartbeatWatcher = manager.dao.WatchHeartbeats(manager.handleHeartbeatEvent)
+	manager.memberWatcher = manager.dao.WatchMemberInfos(manager.handleMemberInfo)
+	manager.cordonWatcher = manager.dao.WatchCordons(manager.handleCordon)
+	manager.loadCordons()
+
+	go func() {
+		defer manager.routines.Done()
+		manager.campaign()
+	}()
+
 	go func() {
-		for manager.running {
-			err := manager.dao.GetHeartbeats(manager.handleHeartbeat)
-			if err != nil {
-				log.Fatal("[FATAL] Cannot check heartbeats.", err)
+		defer manager.routines.Done()
+		for {
+			manager.checkHeartbeats()
+			if !manager.sleep(time.Duration(manager.config.CheckHeartbeatInterval)) {
+				return
 			}
-			manager.checkLeader()
-			time.Sleep(time.Duration(manager.config.CheckHeartbeatInterval))
 		}
 	}()
 
 	log.Println("[INFO-Cluster] Start Cluster Manager.")
 }
 
-// Dispose stop goroutins
+// isDisposed returns true once Dispose is called
+func (manager *Manager) isDisposed() bool {
+	select {
+	case <-manager.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d, and returns false if the manager is disposed meanwhile
+func (manager *Manager) sleep(d time.Duration) bool {
+	select {
+	case <-manager.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// Dispose stop goroutins .. Returns after goroutines and watch handlers end.
 func (manager *Manager) Dispose() {
-	manager.running = false
+	if manager.done != nil && !manager.isDisposed() {
+		close(manager.done)
+	}
+	manager.stopCampaign()
+	for _, watcher := range []*kv.Watcher{manager.heartbeatWatcher, manager.memberWatcher, manager.cordonWatcher} {
+		if watcher != nil {
+			watcher.Stop()
+			<-watcher.Done()
+		}
+	}
+	manager.heartbeatWatcher = nil
+	manager.memberWatcher = nil
+	manager.cordonWatcher = nil
+	manager.routines.Wait()
+	if manager.lease != kv.NoLease {
+		err := manager.dao.RevokeHeartbeatLease(manager.lease)
+		if err != nil {
+			log.Println("[WARN-Cluster] Revoke heartbeat lease ", err)
+		}
+		manager.lease = kv.NoLease
+	}
+	if manager.cluster.localMember.Draining {
+		manager.leave()
+	}
 	log.Println("[WARN-Cluster] Dispose Cluster Manager.")
 }
 
+// Drain marks local member draining. Jobs of a draining member are moved to other members,
+// and it leaves the cluster when the manager is disposed.
+func (manager *Manager) Drain() (err error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	local := manager.cluster.localMember
+	if local.Draining {
+		return nil
+	}
+	manager.cluster.setDraining(local, true)
+	err = manager.dao.PutMemberInfo(*local)
+	if err != nil {
+		manager.cluster.setDraining(local, false)
+		return err
+	}
+	manager.memberInfoStored = true
+	log.Println("[INFO-Cluster] Local member is draining.")
+	manager.onMemberChanged(local)
+	return nil
+}
+
+// IsDraining : returns whether local member is draining
+func (manager *Manager) IsDraining() bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return manager.cluster.localMember.Draining
+}
+
+// Cordon : member gets no new jobs, but keeps running its jobs
+func (manager *Manager) Cordon(id string) error {
+	return manager.dao.PutCordon(id)
+}
+
+// Uncordon ..
+func (manager *Manager) Uncordon(id string) error {
+	return manager.dao.DeleteCordon(id)
+}
+
+// GetCordons returns ids of cordoned members
+func (manager *Manager) GetCordons() (ids []string, err error) {
+	return manager.dao.GetCordons()
+}
+
+func (manager *Manager) loadCordons() {
+	ids, err := manager.dao.GetCordons()
+	if err != nil {
+		log.Println("[ERROR-Cluster] Cannot read cordoned members.", err)
+		return
+	}
+	for _, id := range ids {
+		manager.handleCordon(id, true)
+	}
+}
+
+// handleCordon follows cordoned members
+func (manager *Manager) handleCordon(id string, cordoned bool) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.cordoned[id] == cordoned {
+		return
+	}
+	if cordoned {
+		manager.cordoned[id] = true
+	} else {
+		delete(manager.cordoned, id)
+	}
+	log.Println("[INFO-Cluster] Member cordoned ", id, cordoned)
+
+	memb := manager.cluster.GetMember(id)
+	if memb != nil {
+		memb.setCordoned(cordoned)
+		manager.onMemberChanged(memb)
+	}
+}
+
+// leave removes heartbeat and member info of local member
+func (manager *Manager) leave() {
+	id := manager.cluster.localMember.ID
+	if err := manager.dao.DeleteHeartbeat(id); err != nil {
+		log.Println("[WARN-Cluster] Delete heartbeat ", err)
+	}
+	if err := manager.dao.DeleteMemberInfo(id); err != nil {
+		log.Println("[WARN-Cluster] Delete member info ", err)
+	}
+	log.Println("[INFO-Cluster] Local member left the cluster.")
+}
+
+// handleMemberInfo follows draining and metadata changes of other members
+func (manager *Manager) handleMemberInfo(info Member) {
+	if manager.isDisposed() {
+		return
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	memb := manager.cluster.GetMember(info.ID)
+	if memb == nil || memb.IsLocal() || memb.sameMetadata(info) {
+		return
+	}
+	if memb.Draining != info.Draining {
+		log.Println("[INFO-Cluster] Member draining ", info.ID, info.Draining)
+	}
+	manager.cluster.setMemberMetadata(memb, info)
+	manager.onMemberChanged(memb)
+}
+
+// sendHeartbeat puts member info until it is stored, and then heartbeat.
+// Errors are logged and retried at next interval while KV store is unreachable.
+func (manager *Manager) sendHeartbeat() {
+	if err := manager.storeMemberInfo(); err != nil {
+		log.Println("[ERROR-Cluster] Cannot put member info.", err)
+		return
+	}
+
+	err := manager.putHeartbeat()
+	if err != nil {
+		log.Println("[ERROR-Cluster] Cannot send heartbeat.", err)
+	}
+}
+
+// storeMemberInfo puts member info of local member unless it is stored. Drain changes it meanwhile.
+func (manager *Manager) storeMemberInfo() error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.memberInfoStored {
+		return nil
+	}
+	err := manager.dao.PutMemberInfo(*manager.cluster.localMember)
+	if err == nil {
+		manager.memberInfoStored = true
+	}
+	return err
+}
+
+func (manager *Manager) putHeartbeat() error {
+	if manager.config.HeartbeatLease && manager.lease == kv.NoLease {
+		lease, err := manager.dao.NewHeartbeatLease(int64(manager.config.AliveThreasholdSeconds))
+		if err != nil {
+			return err
+		}
+		manager.lease = lease
+	}
+
+	err := manager.dao.PutHeartbeat(manager.cluster.localMember.ID, manager.lease)
+	if err == kv.ErrLeaseNotFound {
+		log.Println("[WARN-Cluster] Heartbeat lease expired. Grant new lease.")
+		manager.lease = kv.NoLease
+		return manager.putHeartbeat()
+	}
+	return err
+}
+
+func (manager *Manager) checkHeartbeats() {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	seen := make(map[string]bool)
+	heartbeats := make(map[string]time.Time)
+	err := manager.dao.GetHeartbeats(func(id string, tm time.Time) {
+		seen[id] = true
+		heartbeats[id] = tm
+		manager.handleHeartbeat(id, tm)
+	})
+	if err != nil {
+		log.Println("[ERROR-Cluster] Cannot check heartbeats.", err)
+		return
+	}
+	if manager.config.HeartbeatLease {
+		manager.checkExpiredMembers(seen)
+	}
+	manager.checkLeader()
+	manager.reapDeadMembers(heartbeats)
+}
+
+// reapDeadMembers removes records of members dead longer than MemberRetentionSeconds. Only the leader reaps.
+// Members without heartbeat are dead since the leader found them.
+func (manager *Manager) reapDeadMembers(heartbeats map[string]time.Time) {
+	retention := time.Duration(manager.config.MemberRetentionSeconds) * time.Second
+	if retention == 0 || !manager.IsLeader() {
+		return
+	}
+
+	ids, err := manager.dao.GetMemberIDs()
+	if err != nil {
+		log.Println("[ERROR-Cluster] Cannot read member infos.", err)
+		return
+	}
+	candidates := make(map[string]bool)
+	for _, id := range ids {
+		candidates[id] = true
+	}
+	for id := range heartbeats {
+		candidates[id] = true
+	}
+
+	now := time.Now()
+	for id := range candidates {
+		memb := manager.cluster.GetMember(id)
+		if id == manager.cluster.localMember.ID || (memb != nil && memb.IsAlive()) {
+			delete(manager.deadSince, id)
+			continue
+		}
+
+		since, ok := heartbeats[id]
+		if !ok {
+			since, ok = manager.deadSince[id]
+			if !ok {
+				manager.deadSince[id] = now
+				continue
+			}
+		}
+		if now.Sub(since) >= retention {
+			manager.reapMember(id, since)
+		}
+	}
+}
+
+// reapMember removes heartbeat, member info and job assignments of a dead member, fenced by the leader term
+func (manager *Manager) reapMember(id string, since time.Time) {
+	leaderKey, term := manager.LeaderKey()
+	if err := manager.dao.DeleteMember(leaderKey, term, id); err != nil {
+		log.Println("[ERROR-Cluster] Cannot remove dead member ", id, err)
+		return
+	}
+	manager.cluster.removeMember(id)
+	delete(manager.deadSince, id)
+	log.Println("[INFO-Cluster] Dead member removed ", id, "dead since", since)
+
+	if manager.memberRemovedHandler != nil {
+		manager.memberRemovedHandler(id)
+	}
+}
+
+// handleHeartbeatEvent reacts to heartbeats between checks : new members join
+// and deleted heartbeats (expired lease) leave at once.
+func (manager *Manager) handleHeartbeatEvent(eventType kv.EventType, id string, tm time.Time) {
+	if manager.isDisposed() {
+		return
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if eventType == kv.EventPut {
+		manager.handleHeartbeat(id, tm)
+		return
+	}
+
+	memb := manager.cluster.GetMember(id)
+	if memb == nil || memb.IsLocal() || !memb.IsAlive() {
+		return
+	}
+	log.Println("[INFO-Cluster] Heartbeat deleted ", id)
+	memb.setAlive(false)
+	manager.onMemberChanged(memb)
+}
+
+// checkExpiredMembers : with heartbeat lease, a member whose heartbeat key is gone is dead.
+func (manager *Manager) checkExpiredMembers(seen map[string]bool) {
+	for _, id := range manager.cluster.GetSortedMembers() {
+		memb := manager.cluster.GetMember(id)
+		if memb.IsLocal() || seen[id] || !memb.IsAlive() {
+			continue
+		}
+		log.Println("[INFO-Cluster] Heartbeat lease expired ", id)
+		memb.setAlive(false)
+		manager.onMemberChanged(memb)
+	}
+}
+
 func (manager *Manager) handleHeartbeat(id string, tm time.Time) {
 	if manager.cluster.Local().ID == id {
 		manager.cluster.Local().setHeartBeat(tm)
@@ -109,13 +452,14 @@ func (manager *Manager) handleHeartbeat(id string, tm time.Time) {
 			log.Println("[ERROR-Cluster] Cannot find member info ", id, err)
 		}
 		memb = &memb2
+		memb.setCordoned(manager.cordoned[id])
 		manager.cluster.putMember(memb)
 		changed = true
 	}
 
 	alive := false
 
-	if memb.IsLocal() {
+	if memb.IsLocal() || manager.config.HeartbeatLease {
 		alive = true
 	} else {
 		if memb.HeartBeat().IsZero() || memb.HeartBeat() == tm {
@@ -145,78 +489,176 @@ func (manager *Manager) handleHeartbeat(id string, tm time.Time) {
 	}
 }
 
+// campaign runs for leader while manager is running. Once elected, local member is the leader
+// until its election session is lost, and then it campaigns again.
+func (manager *Manager) campaign() {
+	for !manager.isDisposed() {
+		election, err := manager.dao.NewElection(int64(manager.config.AliveThreasholdSeconds))
+		if err != nil {
+			log.Println("[ERROR-Cluster] Cannot create election session.", err)
+			if !manager.sleep(time.Duration(manager.config.CheckHeartbeatInterval)) {
+				return
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		manager.mutex.Lock()
+		manager.election = election
+		manager.cancelCampaign = cancel
+		running := !manager.isDisposed()
+		manager.mutex.Unlock()
+
+		if running {
+			term, err := election.Campaign(ctx, manager.cluster.Local().ID)
+			if err == nil {
+				manager.becomeLeader(election.Key(), term)
+
+				select {
+				case <-election.Done():
+					log.Println("[WARN-Cluster] Election session is lost.")
+				case <-ctx.Done():
+				}
+
+				manager.resignLeader(term)
+			} else if ctx.Err() == nil {
+				log.Println("[ERROR-Cluster] Campaign for leader.", err)
+			}
+		}
+
+		cancel()
+		election.Close()
+	}
+}
+
+func (manager *Manager) stopCampaign() {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.cancelCampaign != nil {
+		manager.cancelCampaign()
+		manager.cancelCampaign = nil
+	}
+	if manager.election != nil {
+		manager.election.Close()
+		manager.election = nil
+	}
+}
+
+func (manager *Manager) becomeLeader(electionKey string, term int64) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	log.Println("[INFO-Cluster] Elected as leader. term:", term)
+	manager.setLeaderKey(electionKey)
+
+	succeeded, err := manager.dao.PutLeader(electionKey, term, manager.cluster.Local().ID)
+	if err != nil || !succeeded {
+		log.Println("[WARN-Cluster] Cannot put leader ", succeeded, err)
+	}
+
+	manager.setLeader(manager.cluster.Local().ID, term)
+}
+
+func (manager *Manager) resignLeader(term int64) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	manager.setLeaderKey("")
+	if manager.cluster.Term() == term && manager.cluster.Leader() != nil {
+		log.Println("[WARN-Cluster] Leadership is lost. term:", term)
+		manager.cluster.setLeader(nil, term)
+	}
+}
+
+// checkLeader follows the leader elected by other members
 func (manager *Manager) checkLeader() {
-	leaderID, err := manager.dao.GetLeader()
-	if err != nil {
-		log.Println("[ERROR] Get Leader ", err)
+	election := manager.election
+	if election == nil {
+		return
 	}
 
-	oldLeader := manager.cluster.leader
+	ctx, cancel := context.WithTimeout(context.Background(), kv.DefaultRequestTimeout)
+	defer cancel()
 
-	if oldLeader != nil {
-		if oldLeader.ID == leaderID {
-			if oldLeader.IsAlive() {
-				return
-			}
-		} else {
-			oldLeader.setLeader(false)
-			manager.cluster.leader = nil
+	leaderID, term, err := election.Leader(ctx)
+	if err != nil {
+		if err != kv.ErrNoLeader {
+			log.Println("[ERROR-Cluster] Get Leader ", err)
 		}
+		return
 	}
 
-	var leader *Member
+	manager.setLeader(leaderID, term)
+}
 
-	if leaderID != "" {
-		leader = manager.cluster.GetMember(leaderID)
-		if leader == nil {
-			leader = manager.electLeader()
-		} else if !leader.IsAlive() {
-			leader.setLeader(false)
-			leader = manager.electLeader()
+// setLeader must be called with lock held. Leader of an older term is ignored.
+func (manager *Manager) setLeader(leaderID string, term int64) {
+	oldLeader := manager.cluster.Leader()
+	if term < manager.cluster.Term() || (term == manager.cluster.Term() && oldLeader != nil) {
+		return
+	}
+	if leaderID != manager.cluster.Local().ID && manager.IsElected() {
+		// local session is not lost yet, wait for it
+		return
+	}
+
+	leader := manager.cluster.GetMember(leaderID)
+	if leader == nil {
+		memb, err := manager.dao.GetMemberInfo(leaderID)
+		if err != nil {
+			log.Println("[ERROR-Cluster] Cannot find leader info ", leaderID, err)
+			return
 		}
-	} else {
-		leader = manager.electLeader()
+		leader = &memb
+		manager.cluster.putMember(leader)
 	}
 
-	leader.setLeader(true)
-	manager.cluster.leader = leader
+	manager.cluster.setLeader(leader, term)
+	log.Println("[INFO-Cluster] Leader ", leaderID, " term:", term)
 
 	manager.onLeaderChanged(leader)
 }
 
-func (manager *Manager) electLeader() *Member {
-	members := manager.cluster.GetSortedMembers()
-
-	fmt.Println("****** electLeader:: len(members) ", len(members))
+// LeaderKey returns election key and term while local member is the leader.
+// Writes only the leader may do are fenced with kv.CreateRevisionEquals(key, term).
+func (manager *Manager) LeaderKey() (key string, term int64) {
+	manager.leaderMutex.RLock()
+	defer manager.leaderMutex.RUnlock()
 
-	for _, id := range members {
-		memb := manager.cluster.GetMember(id)
-		fmt.Println("    ****** electLeader:: member ", id, memb)
-		if memb.IsAlive() {
-			manager.dao.PutLeader(id)
-			return memb
-		}
+	if manager.leaderKey == "" {
+		return "", 0
 	}
+	return manager.leaderKey, manager.cluster.Term()
+}
+
+// IsElected : returns whether local member holds the leadership of current term
+func (manager *Manager) IsElected() bool {
+	manager.leaderMutex.RLock()
+	defer manager.leaderMutex.RUnlock()
+	return manager.leaderKey != ""
+}
 
-	local := manager.cluster.Local()
-	manager.dao.PutLeader(local.ID)
-	return local
+func (manager *Manager) setLeaderKey(key string) {
+	manager.leaderMutex.Lock()
+	defer manager.leaderMutex.Unlock()
+	manager.leaderKey = key
 }
 
 // IsLeader : returns whether this kernel is leader.
 func (manager *Manager) IsLeader() bool {
-	return manager.cluster.localMember.IsLeader()
+	return manager.cluster.isLeader(manager.cluster.localMember)
 }
 
 func (manager *Manager) onMemberChanged(memb *Member) {
-	if manager.cluster.localMember.IsLeader() && manager.memberChangeHandler != nil {
+	if manager.IsLeader() && manager.memberChangeHandler != nil {
 		log.Println("[INFO-Cluster] Member Changed::", memb)
 		manager.memberChanged()
 	}
 }
 
 func (manager *Manager) onLeaderChanged(leader *Member) {
-	if manager.cluster.localMember.IsLeader() && manager.memberChangeHandler != nil {
+	if manager.IsLeader() && manager.memberChangeHandler != nil {
 		log.Println("[INFO-Cluster] Leader changed. I'm the leader")
 		manager.memberChanged()
 	}
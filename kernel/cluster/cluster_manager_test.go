@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
+	"github.com/rhizomata/bridge-chain-etcd/kernel/model"
+)
+
+func testConfig() model.Config {
+	return model.Config{Cluster: "c1", Name: "n1", Hostname: "127.0.0.1", Port: 1,
+		HeartbeatInterval: uint(100 * time.Millisecond), CheckHeartbeatInterval: uint(100 * time.Millisecond),
+		AliveThreasholdSeconds: 2}
+}
+
+// waitMembers waits until the leader reports alive members for which matches returns true
+func waitMembers(t *testing.T, changes chan []string, what string, matches func(alive map[string]bool) bool) {
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case ids := <-changes:
+			alive := make(map[string]bool)
+			for _, id := range ids {
+				alive[id] = true
+			}
+			if matches(alive) {
+				return
+			}
+		case <-deadline:
+			t.Fatal("timed out:", what)
+		}
+	}
+}
+
+func TestHeartbeatLeaseLiveness(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+
+	config := testConfig()
+	config.HeartbeatLease = true
+	manager := NewManager("n1", config, store)
+	changes := make(chan []string, 100)
+	manager.SetMemberChangeHandler(func(aliveMembers []string) { changes <- aliveMembers })
+	manager.Start()
+	defer manager.Dispose()
+
+	// n2 joins with its own heartbeat lease
+	other := newDAO("c1", store)
+	other.PutMemberInfo(Member{ID: "n2"})
+	lease, err := other.NewHeartbeatLease(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = other.PutHeartbeat("n2", lease); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(t, changes, "n2 is alive", func(alive map[string]bool) bool { return alive["n1"] && alive["n2"] })
+
+	// n2 is dead once its lease is gone, regardless of heartbeat time
+	if err = other.RevokeHeartbeatLease(lease); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(t, changes, "n2 is dead", func(alive map[string]bool) bool { return alive["n1"] && !alive["n2"] })
+}
+
+func TestDrainAndLeave(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+
+	manager := NewManager("n1", testConfig(), store)
+	changes := make(chan []string, 100)
+	manager.SetMemberChangeHandler(func(aliveMembers []string) { changes <- aliveMembers })
+	manager.Start()
+	defer manager.Dispose()
+	deadline := time.Now().Add(5 * time.Second)
+	for !manager.IsElected() {
+		if time.Now().After(deadline) {
+			t.Fatal("n1 is not elected")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	config := testConfig()
+	config.Name = "n2"
+	other := NewManager("n2", config, store)
+	other.Start()
+	waitMembers(t, changes, "n2 is alive", func(alive map[string]bool) bool { return alive["n1"] && alive["n2"] })
+
+	if err := other.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	if !other.IsDraining() {
+		t.Fatal("n2 is not draining")
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for len(manager.GetCluster().GetActiveMemberIDs()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("draining n2 is active", manager.GetCluster().GetActiveMemberIDs())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// draining member leaves the cluster on Dispose
+	other.Dispose()
+	dao := newDAO("c1", store)
+	if _, err := dao.GetMemberInfo("n2"); err == nil {
+		t.Fatal("member info of left member is kept")
+	}
+	if _, err := dao.GetHeartbeat("n2"); err == nil {
+		t.Fatal("heartbeat of left member is kept")
+	}
+	if _, err := dao.GetMemberInfo("n1"); err != nil {
+		t.Fatal("member info of running member is deleted", err)
+	}
+}
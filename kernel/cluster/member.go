@@ -8,10 +8,17 @@ type Member struct {
 	ID        string `json:"id"`
 	Name      string `json:"name"`
 	DaemonURL string `json:"url"`
+	// Draining member keeps running but gets no jobs, and leaves the cluster on shutdown
+	Draining bool              `json:"draining"`
+	Zone     string            `json:"zone,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Capacity max total weight of jobs of the member. Zero is unlimited.
+	Capacity  int `json:"capacity,omitempty"`
 	heartbeat time.Time
 	leader    bool
 	alive     bool
 	local     bool
+	cordoned  bool
 }
 
 //HeartBeat return member's last heartbeat time
@@ -44,6 +51,44 @@ func (memb *Member) setAlive(alive bool) {
 	memb.alive = alive
 }
 
+// Label returns the value of label key
+func (memb *Member) Label(key string) (value string, ok bool) {
+	value, ok = memb.Labels[key]
+	return value, ok
+}
+
+// setMetadata copies draining and placement metadata of info
+func (memb *Member) setMetadata(info Member) {
+	memb.Draining = info.Draining
+	memb.Zone = info.Zone
+	memb.Labels = info.Labels
+	memb.Capacity = info.Capacity
+}
+
+// sameMetadata returns whether draining and placement metadata of info are same
+func (memb *Member) sameMetadata(info Member) bool {
+	if memb.Draining != info.Draining || memb.Zone != info.Zone || memb.Capacity != info.Capacity ||
+		len(memb.Labels) != len(info.Labels) {
+		return false
+	}
+	for key, value := range info.Labels {
+		if value2, ok := memb.Labels[key]; !ok || value2 != value {
+			return false
+		}
+	}
+	return true
+}
+
+// IsCordoned return whether member gets no new jobs
+func (memb *Member) IsCordoned() bool {
+	return memb.cordoned
+}
+
+// setCordoned Set member cordoned
+func (memb *Member) setCordoned(cordoned bool) {
+	memb.cordoned = cordoned
+}
+
 //IsLocal return whether member is alive
 func (memb *Member) IsLocal() bool {
 	return memb.local
@@ -0,0 +1,44 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// EnvelopeVersion version of the job envelope format
+const EnvelopeVersion = 1
+
+// envelope : stored format of a job with its metadata. Jobs stored by older versions are raw data.
+type envelope struct {
+	Envelope  int               `json:"envelope"`
+	Name      string            `json:"name,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Creator   string            `json:"creator,omitempty"`
+	Version   int64             `json:"version"`
+	Paused    bool              `json:"paused,omitempty"`
+	Data      []byte            `json:"data"`
+}
+
+// encodeJob wraps job data and metadata in the envelope
+func encodeJob(job Job) ([]byte, error) {
+	return json.Marshal(envelope{Envelope: EnvelopeVersion, Name: job.Name, Labels: job.Labels,
+		CreatedAt: job.CreatedAt, UpdatedAt: job.UpdatedAt, Creator: job.Creator, Version: job.Version,
+		Paused: job.Paused, Data: job.Data})
+}
+
+// decodeJob reads a job in the envelope, or raw data stored by older versions
+func decodeJob(jobID string, value []byte) Job {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		env := envelope{}
+		if err := json.Unmarshal(trimmed, &env); err == nil && env.Envelope > 0 {
+			return Job{ID: jobID, Data: env.Data, Name: env.Name, Labels: env.Labels,
+				CreatedAt: env.CreatedAt, UpdatedAt: env.UpdatedAt, Creator: env.Creator, Version: env.Version,
+				Paused: env.Paused}
+		}
+	}
+	return Job{ID: jobID, Data: value}
+}
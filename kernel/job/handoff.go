@@ -0,0 +1,155 @@
+package job
+
+import (
+	"log"
+	"time"
+)
+
+// SetHandoffTimeout : jobs moving between members are assigned to the new member after the previous owner
+// acknowledges the release, or after timeout. Zero timeout moves jobs at once.
+func (manager *Manager) SetHandoffTimeout(timeout time.Duration) {
+	manager.handoffTimeout = timeout
+}
+
+// SetHandoffAckHandler : Set handler called when a handoff is acknowledged by the previous owner
+func (manager *Manager) SetHandoffAckHandler(handler func(jobID string, handoff Handoff)) {
+	manager.handoffAckHandler = handler
+}
+
+// GetHandoffs : returns jobID-Handoff map of jobs moving between members
+func (manager *Manager) GetHandoffs() (handoffs map[string]Handoff, err error) {
+	return manager.dao.GetHandoffs()
+}
+
+func (manager *Manager) watchHandoffs() {
+	manager.setWatcher(&manager.handoffWatcher, manager.dao.WatchHandoffs(
+		func(jobID string, handoff Handoff) {
+			if handoff.Acked && manager.handoffAckHandler != nil {
+				manager.handoffAckHandler(jobID, handoff)
+			}
+		}))
+}
+
+// planHandoffs holds back jobs moving from an alive owner, and returns member jobs to write
+// with handoffs to put and to remove.
+func (manager *Manager) planHandoffs(membJobMap map[string][]string, aliveMembers []string) (
+	assignments map[string][]string, handoffs map[string]Handoff, removed []string, err error) {
+	fences, err := manager.dao.GetFences()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pending, err := manager.dao.GetHandoffs()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	alive := make(map[string]bool)
+	for _, membID := range aliveMembers {
+		alive[membID] = true
+	}
+
+	now := time.Now()
+	assignments = make(map[string][]string)
+	handoffs = make(map[string]Handoff)
+	removed = []string{}
+	targets := make(map[string]string)
+
+	for membID, jobIDs := range membJobMap {
+		kept := []string{}
+		for _, jobID := range jobIDs {
+			targets[jobID] = membID
+			if handoff, ok := pending[jobID]; ok {
+				if handoff.From == membID {
+					// moved back to the previous owner
+					removed = append(removed, jobID)
+					kept = append(kept, jobID)
+				} else if handoff.To != membID {
+					handoff.To = membID
+					handoffs[jobID] = handoff
+				}
+				continue
+			}
+			fence, ok := fences[jobID]
+			if manager.handoffTimeout > 0 && ok && fence.Member != membID && alive[fence.Member] {
+				handoffs[jobID] = Handoff{From: fence.Member, To: membID, Since: now}
+				continue
+			}
+			kept = append(kept, jobID)
+		}
+		assignments[membID] = kept
+	}
+
+	for jobID := range pending {
+		if _, ok := targets[jobID]; !ok {
+			removed = append(removed, jobID)
+		}
+	}
+	return assignments, handoffs, removed, nil
+}
+
+// ActivateHandoffs assigns handed off jobs to their new members, when the previous owner acknowledged,
+// is not alive or the handoff timed out. Writes are fenced by the election key and term of the leader.
+func (manager *Manager) ActivateHandoffs(leaderKey string, term int64, aliveMembers []string) (err error) {
+	if leaderKey == "" {
+		return ErrNotLeader
+	}
+	handoffs, err := manager.dao.GetHandoffs()
+	if err != nil || len(handoffs) == 0 {
+		return err
+	}
+
+	alive := make(map[string]bool)
+	for _, membID := range aliveMembers {
+		alive[membID] = true
+	}
+
+	membJobMap, err := manager.dao.GetAllMemberJobIDs()
+	if err != nil {
+		return err
+	}
+
+	removed := []string{}
+	for jobID, handoff := range handoffs {
+		timedOut := time.Since(handoff.Since) > manager.handoffTimeout
+		if !handoff.Acked && alive[handoff.From] && !timedOut {
+			continue
+		}
+		if timedOut && !handoff.Acked {
+			log.Println("[WARN-JobMan] Handoff timed out ", jobID, handoff.From, "->", handoff.To)
+		} else {
+			log.Println("[INFO-JobMan] Handoff activated ", jobID, handoff.From, "->", handoff.To)
+		}
+		membJobMap[handoff.To] = append(membJobMap[handoff.To], jobID)
+		removed = append(removed, jobID)
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+	return manager.dao.PutAllMemberJobs(leaderKey, term, membJobMap, nil, removed)
+}
+
+// AckHandoffs acknowledges handoffs of jobs released by local member. jobIDs are jobs local member still runs.
+func (manager *Manager) AckHandoffs(jobIDs []string) (err error) {
+	handoffs, err := manager.dao.GetHandoffs()
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]bool)
+	for _, jobID := range jobIDs {
+		running[jobID] = true
+	}
+
+	for jobID, handoff := range handoffs {
+		if handoff.From != manager.localid || handoff.Acked || running[jobID] {
+			continue
+		}
+		err2 := manager.dao.AckHandoff(jobID)
+		if err2 != nil {
+			log.Println("[ERROR-JobMan] Cannot acknowledge handoff ", jobID, err2)
+			err = err2
+		}
+	}
+	return err
+}
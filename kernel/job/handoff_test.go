@@ -0,0 +1,93 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
+)
+
+// newHandoffTest returns manager of leader "A" with handoff timeout, and key and term of its leadership
+func newHandoffTest(t *testing.T, store kv.KV, timeout time.Duration) (manager *Manager, leaderKey string, term int64) {
+	manager = NewManager("c1", "A", store)
+	manager.SetHandoffTimeout(timeout)
+	leaderKey, term = putLeader(t, store)
+	return manager, leaderKey, term
+}
+
+func TestHandoffWaitsForAck(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager, leaderKey, term := newHandoffTest(t, store, time.Minute)
+	alive := []string{"A", "B"}
+
+	if err := manager.SetAllMemberJobIDs(leaderKey, term, map[string][]string{"A": {"j1", "j2"}, "B": {}}, alive); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.SetAllMemberJobIDs(leaderKey, term, map[string][]string{"A": {"j1"}, "B": {"j2"}}, alive); err != nil {
+		t.Fatal(err)
+	}
+	membJobMap, _ := manager.GetAllMemberJobIDs()
+	handoffs, _ := manager.GetHandoffs()
+	if len(membJobMap["B"]) != 0 || handoffs["j2"].From != "A" || handoffs["j2"].To != "B" {
+		t.Fatal("moving job is not held", membJobMap, handoffs)
+	}
+
+	if err := manager.ActivateHandoffs(leaderKey, term, alive); err != nil {
+		t.Fatal(err)
+	}
+	if membJobMap, _ = manager.GetAllMemberJobIDs(); len(membJobMap["B"]) != 0 {
+		t.Fatal("handoff is activated before ack", membJobMap)
+	}
+
+	// A released j2
+	if err := manager.AckHandoffs([]string{"j1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.ActivateHandoffs(leaderKey, term, alive); err != nil {
+		t.Fatal(err)
+	}
+	membJobMap, _ = manager.GetAllMemberJobIDs()
+	handoffs, _ = manager.GetHandoffs()
+	fences, _ := manager.dao.GetFences()
+	if len(membJobMap["B"]) != 1 || len(handoffs) != 0 || fences["j2"].Member != "B" {
+		t.Fatal("acked handoff is not activated", membJobMap, handoffs, fences)
+	}
+}
+
+func TestHandoffTimeout(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager, leaderKey, term := newHandoffTest(t, store, 100*time.Millisecond)
+	alive := []string{"A", "B"}
+
+	manager.SetAllMemberJobIDs(leaderKey, term, map[string][]string{"A": {}, "B": {"j1"}}, alive)
+	if err := manager.SetAllMemberJobIDs(leaderKey, term, map[string][]string{"A": {"j1"}, "B": {}}, alive); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := manager.ActivateHandoffs(leaderKey, term, alive); err != nil {
+		t.Fatal(err)
+	}
+	membJobMap, _ := manager.GetAllMemberJobIDs()
+	fences, _ := manager.dao.GetFences()
+	if len(membJobMap["A"]) != 1 || fences["j1"].Member != "A" {
+		t.Fatal("timed out handoff is not activated", membJobMap, fences)
+	}
+}
+
+func TestHandoffFromDeadMember(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager, leaderKey, term := newHandoffTest(t, store, time.Minute)
+
+	manager.SetAllMemberJobIDs(leaderKey, term, map[string][]string{"A": {}, "B": {"j1"}}, []string{"A", "B"})
+	if err := manager.SetAllMemberJobIDs(leaderKey, term, map[string][]string{"A": {"j1"}}, []string{"A"}); err != nil {
+		t.Fatal(err)
+	}
+	membJobMap, _ := manager.GetAllMemberJobIDs()
+	if len(membJobMap["A"]) != 1 {
+		t.Fatal("job of dead member must move at once", membJobMap)
+	}
+}
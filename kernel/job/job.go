@@ -2,14 +2,90 @@ package job
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
 )
 
 // Job job data structure
 type Job struct {
 	ID   string
 	Data []byte
+	// Name human readable name of the job
+	Name   string
+	Labels map[string]string
+	// CreatedAt, UpdatedAt are zero for jobs stored in raw format by older versions
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Creator   string
+	// Version spec version of the job
+	Version int64
+	// Paused jobs keep their data, but are assigned to no member
+	Paused bool
+	// Placement constraints of the job. nil is placed anywhere.
+	Placement *Placement
+	// Weight relative cost of the job, weighed by worker factory when jobs are distributed
+	Weight int
+}
+
+// Cost returns weight of the job, at least 1
+func (job *Job) Cost() int {
+	if job.Weight < 1 {
+		return 1
+	}
+	return job.Weight
+}
+
+// Placement : placement constraints of a job
+type Placement struct {
+	// RequiredLabels labels a member must have to run the job
+	RequiredLabels map[string]string `json:"requiredLabels,omitempty"`
+	// AntiAffinity jobs of a same anti-affinity group run on different members
+	AntiAffinity string `json:"antiAffinity,omitempty"`
+	// PreferredZone zone to run the job, while a member of the zone can run it
+	PreferredZone string `json:"preferredZone,omitempty"`
+	// PinnedTo id of the member to run the job, regardless of other constraints and organizers
+	PinnedTo string `json:"pinnedTo,omitempty"`
+}
+
+// IsEmpty whether the placement has no constraint and no pin
+func (placement *Placement) IsEmpty() bool {
+	return len(placement.RequiredLabels) == 0 && placement.AntiAffinity == "" && placement.PreferredZone == "" &&
+		placement.PinnedTo == ""
+}
+
+// Event : a change of a job. Job.Data is nil when the job is removed.
+type Event struct {
+	Type kv.EventType
+	Job  Job
+}
+
+// IsRemoved whether the job is removed
+func (event *Event) IsRemoved() bool {
+	return event.Type == kv.EventDelete
+}
+
+// MemberJobs : jobs assigned to a member by the leader of Term
+type MemberJobs struct {
+	Term int64    `json:"term"`
+	Jobs []string `json:"jobs"`
+}
+
+// Fence : owner of a job, assigned by the leader of Term.
+// ModRevision of the fence is the fencing token of the owner, and changes whenever the job moves.
+type Fence struct {
+	Member string `json:"member"`
+	Term   int64  `json:"term"`
+}
+
+// Handoff : a job moving From a member To another member.
+// The job is assigned to To after From acknowledges it released the job, or after the handoff timeout.
+type Handoff struct {
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Since time.Time `json:"since"`
+	Acked bool      `json:"acked"`
 }
 
 // NewJob ..
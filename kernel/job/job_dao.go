@@ -1,7 +1,9 @@
 package job
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 
@@ -9,88 +11,452 @@ import (
 )
 
 const (
-	kvDirSys           = "/$sys/"
-	kvDirClusters      = kvDirSys + "clstrs/"
-	kvDirMemberJob     = kvDirClusters + "%s/membjob/"
-	kvPatternMemberJob = kvDirMemberJob + "%s"
-	kvPatternJobsDir   = kvDirClusters + "%s/jobs/"
-	kvPatternJob       = kvPatternJobsDir + "%s"
+	kvDirSys            = "/$sys/"
+	kvDirClusters       = kvDirSys + "clstrs/"
+	kvPatternClusterDir = kvDirClusters + "%s/"
+	kvDirMemberJob      = "membjob/"
+	kvPatternMemberJob  = kvDirMemberJob + "%s"
+	kvDirJobs           = "jobs/"
+	kvPatternJob        = kvDirJobs + "%s"
+	kvDirFence          = "fence/"
+	kvPatternFence      = kvDirFence + "%s"
+	kvDirHandoff        = "handoff/"
+	kvPatternHandoff    = kvDirHandoff + "%s"
+	kvDirPlacement      = "placement/"
+	kvPatternPlacement  = kvDirPlacement + "%s"
+	kvPatternStatus     = "status/%s"
+	kvPatternCheckpoint = "checkpoint/%s"
+	kvPatternDataJobID  = "data/%s/"
+	// child helpers of a job keep checkpoints and data with "<jobID>-<subID>"
+	kvPatternChildCheckpoint = "checkpoint/%s-"
+	kvPatternChildData       = "data/%s-"
 )
 
+// ErrNotLeader returned when member jobs are written by a member which is not the leader
+var ErrNotLeader = errors.New("Member jobs can only be written by the leader")
+
+// ErrJobChanged returned when a job keeps changing while it is updated
+var ErrJobChanged = errors.New("Job is changed by another request")
+
+const updateRetries = 3
+
 // DAO kv store model for job
 type DAO struct {
 	cluster string
-	kv      kv.KV
+	// kv view of the cluster directory
+	kv kv.KV
+}
+
+// newDAO ..
+func newDAO(cluster string, store kv.KV) *DAO {
+	return &DAO{cluster: cluster, kv: kv.NewNamespace(store, fmt.Sprintf(kvPatternClusterDir, cluster))}
+}
+
+// parseMemberJobs reads MemberJobs, or a plain list of job ids written by older versions
+func parseMemberJobs(value []byte) (memberJobs MemberJobs, err error) {
+	memberJobs = MemberJobs{Jobs: []string{}}
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &memberJobs.Jobs)
+	} else {
+		err = json.Unmarshal(trimmed, &memberJobs)
+	}
+	if memberJobs.Jobs == nil {
+		memberJobs.Jobs = []string{}
+	}
+	return memberJobs, err
 }
 
 // GetMemberJobs ..
 func (dao *DAO) GetMemberJobs(membID string) (jobIDs []string, err error) {
+	value, err := dao.kv.GetOne(fmt.Sprintf(kvPatternMemberJob, membID))
+	if err != nil {
+		return []string{}, err
+	}
+	memberJobs, err := parseMemberJobs(value)
+	return memberJobs.Jobs, err
+}
+
+// GetMemberJobsWithRevision returns member jobs and the store revision of the read
+func (dao *DAO) GetMemberJobsWithRevision(membID string) (jobIDs []string, revision int64, err error) {
 	jobIDs = []string{}
-	err = dao.kv.GetObject(fmt.Sprintf(kvPatternMemberJob, dao.cluster, membID), jobIDs)
-	return jobIDs, err
+	value, revision, err := dao.kv.GetOneWithStoreRevision(fmt.Sprintf(kvPatternMemberJob, membID))
+	if errors.Is(err, kv.ErrNotFound) {
+		return jobIDs, revision, nil
+	}
+	if err != nil {
+		return jobIDs, revision, err
+	}
+	memberJobs, err := parseMemberJobs(value)
+	if err != nil {
+		log.Println("[ERROR-JobDao] unmarshal member jobs ", membID, err)
+	}
+	return memberJobs.Jobs, revision, nil
 }
 
 // GetAllMemberJobIDs : returns member-JobIDs Map
 func (dao *DAO) GetAllMemberJobIDs() (membJobMap map[string][]string, err error) {
 	membJobMap = make(map[string][]string)
-	dirPath := fmt.Sprintf(kvDirMemberJob, dao.cluster)
+	dirPath := kvDirMemberJob
 	err = dao.kv.GetWithPrefix(dirPath,
 		func(key string, value []byte) {
-			jobIDs := []string{}
-			err := json.Unmarshal(value, &jobIDs)
+			memberJobs, err := parseMemberJobs(value)
 			if err != nil {
 				log.Println("[ERROR-JobDao] unmarshal member jobs ", key, err)
 			}
 			membid := key[len(dirPath):]
-			membJobMap[membid] = jobIDs
+			membJobMap[membid] = memberJobs.Jobs
 		})
 
 	return membJobMap, err
 }
 
-// PutMemberJobs ..
-func (dao *DAO) PutMemberJobs(membID string, jobIDs []string) (err error) {
-	_, err = dao.kv.PutObject(fmt.Sprintf(kvPatternMemberJob, dao.cluster, membID), jobIDs)
+// GetFences : returns jobID-Fence map
+func (dao *DAO) GetFences() (fences map[string]Fence, err error) {
+	fences = make(map[string]Fence)
+	err = dao.kv.GetWithPrefix(kvDirFence,
+		func(key string, value []byte) {
+			fence := Fence{}
+			err := json.Unmarshal(value, &fence)
+			if err != nil {
+				log.Println("[ERROR-JobDao] unmarshal fence ", key, err)
+				return
+			}
+			fences[key[len(kvDirFence):]] = fence
+		})
+	return fences, err
+}
+
+// PutMemberJobs writes jobs of a member, only while the election key of the leader is still created at term.
+// Jobs moved from other members are fenced to membID.
+func (dao *DAO) PutMemberJobs(leaderKey string, term int64, membID string, jobIDs []string) (err error) {
+	fences, err := dao.GetFences()
+	if err != nil {
+		return err
+	}
+
+	ops, err := memberJobsOps(term, membID, jobIDs, fences)
+	if err != nil {
+		return err
+	}
+	return dao.leaderTxn(leaderKey, term, ops)
+}
+
+// PutAllMemberJobs writes all member jobs and handoffs atomically, only while the election key of the leader
+// is still created at term. Jobs moved to another member are fenced to the new owner,
+// and fences of jobs assigned to no member and not handed off are deleted.
+func (dao *DAO) PutAllMemberJobs(leaderKey string, term int64, membJobMap map[string][]string,
+	handoffs map[string]Handoff, removedHandoffs []string) (err error) {
+	fences, err := dao.GetFences()
+	if err != nil {
+		return err
+	}
+	pending, err := dao.GetHandoffs()
+	if err != nil {
+		return err
+	}
+
+	ops := []kv.Op{}
+	assigned := make(map[string]bool)
+	for _, jobID := range removedHandoffs {
+		delete(pending, jobID)
+		ops = append(ops, kv.OpDelete(fmt.Sprintf(kvPatternHandoff, jobID)))
+	}
+	for jobID, handoff := range handoffs {
+		pending[jobID] = handoff
+		op, err := kv.OpPutObject(fmt.Sprintf(kvPatternHandoff, jobID), handoff)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, op)
+	}
+	for jobID := range pending {
+		assigned[jobID] = true
+	}
+
+	for membID, jobIDs := range membJobMap {
+		membOps, err := memberJobsOps(term, membID, jobIDs, fences)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, membOps...)
+		for _, jobID := range jobIDs {
+			assigned[jobID] = true
+		}
+	}
+
+	for jobID := range fences {
+		if !assigned[jobID] {
+			ops = append(ops, kv.OpDelete(fmt.Sprintf(kvPatternFence, jobID)))
+		}
+	}
+
+	return dao.leaderTxn(leaderKey, term, ops)
+}
+
+func memberJobsOps(term int64, membID string, jobIDs []string, fences map[string]Fence) (ops []kv.Op, err error) {
+	op, err := kv.OpPutObject(fmt.Sprintf(kvPatternMemberJob, membID), MemberJobs{Term: term, Jobs: jobIDs})
+	if err != nil {
+		return nil, err
+	}
+	ops = []kv.Op{op}
+
+	for _, jobID := range jobIDs {
+		if fence, ok := fences[jobID]; ok && fence.Member == membID {
+			continue
+		}
+		op, err := kv.OpPutObject(fmt.Sprintf(kvPatternFence, jobID), Fence{Member: membID, Term: term})
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func (dao *DAO) leaderTxn(leaderKey string, term int64, ops []kv.Op) (err error) {
+	compare := kv.CreateRevisionEquals(leaderKey, term)
+	succeeded, _, err := dao.kv.Txn([]kv.Compare{compare}, ops)
+	if err == nil && !succeeded {
+		err = ErrNotLeader
+	}
 	return err
 }
 
-// WatchMemberJobs ..
-func (dao *DAO) WatchMemberJobs(memberID string, handler func(jobIDs []string)) (watcher *kv.Watcher) {
-	dirPath := fmt.Sprintf(kvPatternMemberJob, dao.cluster, memberID)
-	watcher = dao.kv.Watch(dirPath,
+// GetHandoffs : returns jobID-Handoff map
+func (dao *DAO) GetHandoffs() (handoffs map[string]Handoff, err error) {
+	handoffs = make(map[string]Handoff)
+	err = dao.kv.GetWithPrefix(kvDirHandoff,
 		func(key string, value []byte) {
-			jobIDs := []string{}
-			err := json.Unmarshal(value, &jobIDs)
+			handoff := Handoff{}
+			err := json.Unmarshal(value, &handoff)
 			if err != nil {
-				log.Println("[ERROR-JobDao] unmarshal member jobs ", memberID, err)
+				log.Println("[ERROR-JobDao] unmarshal handoff ", key, err)
+				return
+			}
+			handoffs[key[len(kvDirHandoff):]] = handoff
+		})
+	return handoffs, err
+}
+
+// AckHandoff marks the handoff of the job acknowledged, unless the handoff changed since it was read.
+func (dao *DAO) AckHandoff(jobID string) (err error) {
+	key := fmt.Sprintf(kvPatternHandoff, jobID)
+	value, revision, err := dao.kv.GetOneWithRevision(key)
+	if errors.Is(err, kv.ErrNotFound) {
+		// already activated
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	handoff := Handoff{}
+	err = json.Unmarshal(value, &handoff)
+	if err != nil {
+		return err
+	}
+	handoff.Acked = true
+	op, err := kv.OpPutObject(key, handoff)
+	if err != nil {
+		return err
+	}
+	_, _, err = dao.kv.Txn([]kv.Compare{kv.ModRevisionEquals(key, revision)}, []kv.Op{op})
+	return err
+}
+
+// WatchHandoffs .. handler is called when handoffs are written
+func (dao *DAO) WatchHandoffs(handler func(jobID string, handoff Handoff)) (watcher *kv.Watcher) {
+	dirPath := kvDirHandoff
+	watcher = dao.kv.WatchEventsWithPrefix(dirPath,
+		func(event kv.Event) {
+			if event.Type != kv.EventPut {
+				return
+			}
+			handoff := Handoff{}
+			err := json.Unmarshal(event.Value, &handoff)
+			if err != nil {
+				log.Println("[ERROR-JobDao] unmarshal handoff ", event.Key, err)
+				return
+			}
+			handler(event.Key[len(dirPath):], handoff)
+		})
+	return watcher
+}
+
+// WatchMemberJobs .. handler gets an empty list when member jobs are deleted.
+// Changes since revision are delivered, and compacted is called if revision is already compacted.
+func (dao *DAO) WatchMemberJobs(memberID string, revision int64, handler func(jobIDs []string),
+	compacted func()) (watcher *kv.Watcher) {
+	dirPath := fmt.Sprintf(kvPatternMemberJob, memberID)
+	watcher = dao.kv.WatchEventsFrom(dirPath, revision,
+		func(event kv.Event) {
+			jobIDs := []string{}
+			if event.Type == kv.EventPut {
+				memberJobs, err := parseMemberJobs(event.Value)
+				if err != nil {
+					log.Println("[ERROR-JobDao] unmarshal member jobs ", memberID, err)
+				}
+				jobIDs = memberJobs.Jobs
 			}
 			handler(jobIDs)
+		},
+		func(compactRevision int64) {
+			compacted()
 		})
 	return watcher
 }
 
 // GetJob ..
 func (dao *DAO) GetJob(jobID string) (job Job, err error) {
-	value, err := dao.kv.GetOne(fmt.Sprintf(kvPatternJob, dao.cluster, jobID))
-	return Job{ID: jobID, Data: value}, err
+	value, err := dao.kv.GetOne(fmt.Sprintf(kvPatternJob, jobID))
+	if err != nil {
+		return Job{ID: jobID, Data: value}, err
+	}
+	job = decodeJob(jobID, value)
+	job.Placement, err = dao.GetPlacement(jobID)
+	return job, err
 }
 
-// PutJob ..
-func (dao *DAO) PutJob(jobID string, value []byte) (err error) {
-	_, err = dao.kv.Put(fmt.Sprintf(kvPatternJob, dao.cluster, jobID), string(value))
+// PutJob puts job in the envelope, with its placement if it has one
+func (dao *DAO) PutJob(job Job) (err error) {
+	value, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	ops := []kv.Op{kv.OpPut(fmt.Sprintf(kvPatternJob, job.ID), string(value))}
+	if job.Placement != nil {
+		op, err := kv.OpPutObject(fmt.Sprintf(kvPatternPlacement, job.ID), *job.Placement)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, op)
+	}
+	_, _, err = dao.kv.Txn(nil, ops)
 	return err
 }
 
-// RemoveJob ..
+// UpdateJob applies update to the stored job. The job is written only if it has not changed since it was read,
+// and ErrJobChanged is returned when it keeps changing.
+func (dao *DAO) UpdateJob(jobID string, update func(job *Job)) (job Job, err error) {
+	key := fmt.Sprintf(kvPatternJob, jobID)
+	for i := 0; i < updateRetries; i++ {
+		value, revision, err := dao.kv.GetOneWithRevision(key)
+		if err != nil {
+			return job, err
+		}
+		job = decodeJob(jobID, value)
+		update(&job)
+		encoded, err := encodeJob(job)
+		if err != nil {
+			return job, err
+		}
+		succeeded, _, err := dao.kv.Txn([]kv.Compare{kv.ModRevisionEquals(key, revision)},
+			[]kv.Op{kv.OpPut(key, string(encoded))})
+		if err != nil || succeeded {
+			return job, err
+		}
+	}
+	log.Println("[ERROR-JobDao] UpdateJob ", jobID, ErrJobChanged)
+	return job, ErrJobChanged
+}
+
+// RemoveJob removes job with its placement, status, fence, handoff, checkpoints and data,
+// including those of child helpers of the job
 func (dao *DAO) RemoveJob(jobID string) (err error) {
-	_, err = dao.kv.DeleteOne(fmt.Sprintf(kvPatternJob, dao.cluster, jobID))
+	_, _, err = dao.kv.Txn(nil, []kv.Op{
+		kv.OpDelete(fmt.Sprintf(kvPatternJob, jobID)),
+		kv.OpDelete(fmt.Sprintf(kvPatternPlacement, jobID)),
+		kv.OpDelete(fmt.Sprintf(kvPatternStatus, jobID)),
+		kv.OpDelete(fmt.Sprintf(kvPatternFence, jobID)),
+		kv.OpDelete(fmt.Sprintf(kvPatternHandoff, jobID)),
+		kv.OpDelete(fmt.Sprintf(kvPatternCheckpoint, jobID)),
+		kv.OpDeleteWithPrefix(fmt.Sprintf(kvPatternChildCheckpoint, jobID)),
+		kv.OpDeleteWithPrefix(fmt.Sprintf(kvPatternDataJobID, jobID)),
+		kv.OpDeleteWithPrefix(fmt.Sprintf(kvPatternChildData, jobID))})
 	return err
 }
 
+// GetPlacement returns nil if the job has no placement
+func (dao *DAO) GetPlacement(jobID string) (placement *Placement, err error) {
+	value, err := dao.kv.GetOne(fmt.Sprintf(kvPatternPlacement, jobID))
+	if errors.Is(err, kv.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	placement = new(Placement)
+	err = json.Unmarshal(value, placement)
+	if err != nil {
+		log.Println("[ERROR-JobDao] unmarshal placement ", jobID, err)
+		return nil, nil
+	}
+	return placement, nil
+}
+
+// GetPlacements : returns jobID-Placement map
+func (dao *DAO) GetPlacements() (placements map[string]*Placement, err error) {
+	placements = make(map[string]*Placement)
+	err = dao.kv.GetWithPrefix(kvDirPlacement,
+		func(key string, value []byte) {
+			placement := new(Placement)
+			err := json.Unmarshal(value, placement)
+			if err != nil {
+				log.Println("[ERROR-JobDao] unmarshal placement ", key, err)
+				return
+			}
+			placements[key[len(kvDirPlacement):]] = placement
+		})
+	return placements, err
+}
+
+// UpdatePlacement applies update to the stored placement, which is empty if the job has none.
+// The placement is written only if it has not changed since it was read, and removed when update empties it.
+func (dao *DAO) UpdatePlacement(jobID string, update func(placement *Placement)) (err error) {
+	key := fmt.Sprintf(kvPatternPlacement, jobID)
+	for i := 0; i < updateRetries; i++ {
+		value, revision, err := dao.kv.GetOneWithRevision(key)
+		if err != nil && !errors.Is(err, kv.ErrNotFound) {
+			return err
+		}
+		placement := Placement{}
+		if value != nil {
+			err = json.Unmarshal(value, &placement)
+			if err != nil {
+				log.Println("[ERROR-JobDao] unmarshal placement ", jobID, err)
+			}
+		}
+		update(&placement)
+		op := kv.OpDelete(key)
+		if !placement.IsEmpty() {
+			op, err = kv.OpPutObject(key, placement)
+			if err != nil {
+				return err
+			}
+		}
+		succeeded, _, err := dao.kv.Txn([]kv.Compare{kv.ModRevisionEquals(key, revision)}, []kv.Op{op})
+		if err != nil || succeeded {
+			return err
+		}
+	}
+	log.Println("[ERROR-JobDao] UpdatePlacement ", jobID, ErrJobChanged)
+	return ErrJobChanged
+}
+
+// WatchPlacements .. handler is called with the job id of changed or deleted placement
+func (dao *DAO) WatchPlacements(handler func(jobID string)) (watcher *kv.Watcher) {
+	dirPath := kvDirPlacement
+	watcher = dao.kv.WatchEventsWithPrefix(dirPath,
+		func(event kv.Event) {
+			handler(event.Key[len(dirPath):])
+		})
+	return watcher
+}
+
 // GetAllJobIDs ..
 func (dao *DAO) GetAllJobIDs() (jobIDs []string, err error) {
 	jobIDs = []string{}
-	dirPath := fmt.Sprintf(kvPatternJobsDir, dao.cluster)
+	dirPath := kvDirJobs
 	err = dao.kv.GetWithPrefix(dirPath,
 		func(key string, value []byte) {
 			jobid := key[len(dirPath):]
@@ -102,25 +468,47 @@ func (dao *DAO) GetAllJobIDs() (jobIDs []string, err error) {
 
 // GetAllJobs ..
 func (dao *DAO) GetAllJobs() (jobs map[string]Job, err error) {
+	jobs, _, err = dao.GetAllJobsWithRevision()
+	return jobs, err
+}
+
+// GetAllJobsWithRevision returns jobs and the revision of the snapshot
+func (dao *DAO) GetAllJobsWithRevision() (jobs map[string]Job, revision int64, err error) {
 	jobs = make(map[string]Job)
-	dirPath := fmt.Sprintf(kvPatternJobsDir, dao.cluster)
-	err = dao.kv.GetWithPrefix(dirPath,
+	dirPath := kvDirJobs
+	revision, err = dao.kv.GetWithPrefixRevision(dirPath,
 		func(key string, value []byte) {
 			jobid := key[len(dirPath):]
-			job := Job{ID: jobid, Data: value}
-			jobs[jobid] = job
+			jobs[jobid] = decodeJob(jobid, value)
 		})
+	if err != nil {
+		return jobs, revision, err
+	}
 
-	return jobs, err
+	placements, err := dao.GetPlacements()
+	for jobid, placement := range placements {
+		if job, ok := jobs[jobid]; ok {
+			job.Placement = placement
+			jobs[jobid] = job
+		}
+	}
+	return jobs, revision, err
 }
 
-// WatchJobs ..
-func (dao *DAO) WatchJobs(handler func(jobid string, data []byte)) (watcher *kv.Watcher) {
-	dirPath := fmt.Sprintf(kvPatternJobsDir, dao.cluster)
-	watcher = dao.kv.WatchWithPrefix(dirPath,
-		func(key string, value []byte) {
-			jobid := key[len(dirPath):]
-			handler(jobid, value)
+// WatchJobs .. Changes since revision are delivered, and compacted is called if revision is already compacted.
+func (dao *DAO) WatchJobs(revision int64, handler func(event Event), compacted func()) (watcher *kv.Watcher) {
+	dirPath := kvDirJobs
+	watcher = dao.kv.WatchEventsWithPrefixFrom(dirPath, revision,
+		func(event kv.Event) {
+			jobid := event.Key[len(dirPath):]
+			if event.Type == kv.EventDelete {
+				handler(Event{Type: event.Type, Job: Job{ID: jobid}})
+				return
+			}
+			handler(Event{Type: event.Type, Job: decodeJob(jobid, event.Value)})
+		},
+		func(compactRevision int64) {
+			compacted()
 		})
 	return watcher
 }
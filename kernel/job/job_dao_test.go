@@ -0,0 +1,75 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
+)
+
+// putLeader writes leader key of cluster c1, and returns the key and term of the leadership
+func putLeader(t *testing.T, store kv.KV) (leaderKey string, term int64) {
+	leaderKey = "leader"
+	term, err := kv.NewNamespace(store, "/$sys/clstrs/c1/").Put(leaderKey, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaderKey, term
+}
+
+func TestMemberJobsFencedByTerm(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager := NewManager("c1", "A", store)
+	leaderKey, term := putLeader(t, store)
+
+	err := manager.SetAllMemberJobIDs(leaderKey, term+1, map[string][]string{"A": {"j1"}}, []string{"A"})
+	if err != ErrNotLeader {
+		t.Fatal("stale leader must not write member jobs", err)
+	}
+	if err = manager.SetMemberJobIDs("", term, "A", []string{"j1"}); err != ErrNotLeader {
+		t.Fatal("member which is not leader must not write member jobs", err)
+	}
+	if membJobMap, _ := manager.GetAllMemberJobIDs(); len(membJobMap["A"]) != 0 {
+		t.Fatal("member jobs are written", membJobMap)
+	}
+
+	if err = manager.SetAllMemberJobIDs(leaderKey, term, map[string][]string{"A": {"j1"}}, []string{"A"}); err != nil {
+		t.Fatal(err)
+	}
+	if membJobMap, _ := manager.GetAllMemberJobIDs(); len(membJobMap["A"]) != 1 {
+		t.Fatal("member jobs of current leader are not written", membJobMap)
+	}
+}
+
+func TestRemoveJobDeletesJobKeys(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	dao := newDAO("c1", store)
+	clusterKV := kv.NewNamespace(store, "/$sys/clstrs/c1/")
+
+	if err := dao.PutJob(Job{ID: "j1", Data: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	removed := []string{"placement/j1", "status/j1", "fence/j1", "handoff/j1", "checkpoint/j1",
+		"checkpoint/j1-sub", "data/j1/r1", "data/j1-sub/r1"}
+	kept := []string{"jobs/j10", "fence/j10", "checkpoint/j10", "data/j10/r1"}
+	for _, key := range append(removed, kept...) {
+		if _, err := clusterKV.Put(key, "{}"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := dao.RemoveJob("j1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range append(removed, "jobs/j1") {
+		if _, err := clusterKV.GetOne(key); err == nil {
+			t.Fatal("key of removed job is kept:", key)
+		}
+	}
+	for _, key := range kept {
+		if _, err := clusterKV.GetOne(key); err != nil {
+			t.Fatal("key of other job is removed:", key, err)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package job
 
 import (
+	"bytes"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
 )
@@ -11,15 +15,27 @@ type Manager struct {
 	cluster             string
 	localid             string
 	dao                 *DAO
-	jobWatchHandler     func(job *Job)
+	jobWatchHandler     func(event Event)
 	jobWatcher          *kv.Watcher
 	membJobWatchHandler func(jobids []string)
 	membJobWatcher      *kv.Watcher
+	jobResyncHandler    func(jobs map[string]Job)
+	handoffAckHandler   func(jobID string, handoff Handoff)
+	handoffWatcher      *kv.Watcher
+	placementHandler    func(jobID string)
+	placementWatcher    *kv.Watcher
+	handoffTimeout      time.Duration
+	// running 1 while watching, read and written atomically
+	running int32
+	// watchMutex guards watchers, which are replaced when they resync
+	watchMutex sync.Mutex
 }
 
+const resyncRetryInterval = time.Second
+
 // NewManager ..
 func NewManager(cluster string, localid string, kv kv.KV) *Manager {
-	manager := Manager{cluster: cluster, localid: localid, dao: &DAO{cluster: cluster, kv: kv}}
+	manager := Manager{cluster: cluster, localid: localid, dao: newDAO(cluster, kv)}
 	return &manager
 }
 
@@ -28,39 +44,224 @@ func (manager *Manager) SetMembJobWatchHandler(handler func(jobids []string)) {
 	manager.membJobWatchHandler = handler
 }
 
-// SetJobWatchHandler : Set JobOrganizer
-func (manager *Manager) SetJobWatchHandler(handler func(job *Job)) {
+// SetJobWatchHandler : Set handler for added, changed and removed jobs
+func (manager *Manager) SetJobWatchHandler(handler func(event Event)) {
 	manager.jobWatchHandler = handler
 }
 
-// Start watchers ..
+// SetPlacementWatchHandler : Set handler for changed and removed placements
+func (manager *Manager) SetPlacementWatchHandler(handler func(jobID string)) {
+	manager.placementHandler = handler
+}
+
+// SetJobResyncHandler : Set handler called with all jobs when job changes could not be followed
+// (watch revision compacted) and jobs are reloaded.
+func (manager *Manager) SetJobResyncHandler(handler func(jobs map[string]Job)) {
+	manager.jobResyncHandler = handler
+}
+
+// Start watchers .. Watchers start from the revision of the current jobs snapshot,
+// so changes made while the manager was not watching are caught up.
 func (manager *Manager) Start() {
-	manager.jobWatcher = manager.dao.WatchJobs(
-		func(jobid string, data []byte) {
+	manager.watchMutex.Lock()
+	atomic.StoreInt32(&manager.running, 1)
+	manager.watchMutex.Unlock()
+
+	_, revision, err := manager.dao.GetAllJobsWithRevision()
+	if err != nil {
+		log.Println("[ERROR-JobMan] Cannot read jobs snapshot. Watch from now.", err)
+	} else {
+		revision++
+	}
+
+	manager.watchJobs(revision)
+	manager.watchMemberJobs(revision)
+	manager.watchHandoffs()
+	manager.setWatcher(&manager.placementWatcher, manager.dao.WatchPlacements(
+		func(jobID string) {
+			if manager.placementHandler != nil {
+				manager.placementHandler(jobID)
+			}
+		}))
+}
+
+func (manager *Manager) watchJobs(revision int64) {
+	watcher := manager.dao.WatchJobs(revision,
+		func(event Event) {
 			if manager.jobWatchHandler != nil {
-				job := Job{ID: jobid, Data: data}
-				manager.jobWatchHandler(&job)
+				manager.jobWatchHandler(event)
 			}
-		})
+		}, manager.resyncJobs)
+	manager.setWatcher(&manager.jobWatcher, watcher)
+}
 
-	manager.membJobWatcher = manager.dao.WatchMemberJobs(manager.localid,
+func (manager *Manager) watchMemberJobs(revision int64) {
+	watcher := manager.dao.WatchMemberJobs(manager.localid, revision,
 		func(jobids []string) {
 			if manager.membJobWatchHandler != nil {
 				manager.membJobWatchHandler(jobids)
 			}
-		})
+		}, manager.resyncMemberJobs)
+	manager.setWatcher(&manager.membJobWatcher, watcher)
+}
+
+// setWatcher replaces the watcher of field. The watcher is stopped at once if the manager is disposed.
+func (manager *Manager) setWatcher(field **kv.Watcher, watcher *kv.Watcher) {
+	manager.watchMutex.Lock()
+	defer manager.watchMutex.Unlock()
 
+	if atomic.LoadInt32(&manager.running) == 0 {
+		watcher.Stop()
+		return
+	}
+	*field = watcher
 }
 
-// Dispose watchers ..
+// resyncJobs reloads all jobs and watches again after the watch revision is compacted.
+func (manager *Manager) resyncJobs() {
+	if atomic.LoadInt32(&manager.running) == 0 {
+		return
+	}
+
+	jobs, revision, err := manager.dao.GetAllJobsWithRevision()
+	if err != nil {
+		log.Println("[ERROR-JobMan] Resync jobs ", err)
+		time.AfterFunc(resyncRetryInterval, manager.resyncJobs)
+		return
+	}
+	log.Println("[WARN-JobMan] Job watch revision is compacted. Resync jobs at ", revision)
+
+	if manager.jobResyncHandler != nil {
+		manager.jobResyncHandler(jobs)
+	}
+	manager.watchJobs(revision + 1)
+}
+
+// resyncMemberJobs reloads local member jobs and watches again after the watch revision is compacted.
+func (manager *Manager) resyncMemberJobs() {
+	if atomic.LoadInt32(&manager.running) == 0 {
+		return
+	}
+
+	jobIDs, revision, err := manager.dao.GetMemberJobsWithRevision(manager.localid)
+	if err != nil {
+		log.Println("[ERROR-JobMan] Resync member jobs ", err)
+		time.AfterFunc(resyncRetryInterval, manager.resyncMemberJobs)
+		return
+	}
+	log.Println("[WARN-JobMan] Member job watch revision is compacted. Resync member jobs at ", revision)
+
+	if manager.membJobWatchHandler != nil {
+		manager.membJobWatchHandler(jobIDs)
+	}
+	manager.watchMemberJobs(revision + 1)
+}
+
+// Dispose watchers .. Returns after watch handlers end. Watchers created by a resync after Dispose
+// are stopped at once.
 func (manager *Manager) Dispose() {
-	manager.jobWatcher.Stop()
-	manager.membJobWatcher.Stop()
+	manager.watchMutex.Lock()
+	atomic.StoreInt32(&manager.running, 0)
+	watchers := []*kv.Watcher{}
+	for _, watcher := range []*kv.Watcher{manager.jobWatcher, manager.membJobWatcher,
+		manager.handoffWatcher, manager.placementWatcher} {
+		if watcher != nil {
+			watchers = append(watchers, watcher)
+		}
+	}
+	manager.watchMutex.Unlock()
+
+	for _, watcher := range watchers {
+		watcher.Stop()
+	}
+	for _, watcher := range watchers {
+		<-watcher.Done()
+	}
 }
 
-// AddJob ..
+// AddJob stores job with its creation time and first spec version
 func (manager *Manager) AddJob(job Job) error {
-	return manager.dao.PutJob(job.ID, job.Data)
+	now := time.Now()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	job.UpdatedAt = now
+	if job.Version < 1 {
+		job.Version = 1
+	}
+	return manager.dao.PutJob(job)
+}
+
+// UpdateJob replaces data, name and labels of the stored job. The version is bumped when data changes,
+// and the owner restarts the worker with the new data keeping its checkpoint.
+func (manager *Manager) UpdateJob(job Job) (updated Job, err error) {
+	updated, err = manager.dao.UpdateJob(job.ID, func(stored *Job) {
+		if !bytes.Equal(stored.Data, job.Data) {
+			stored.Data = job.Data
+			stored.Version++
+		}
+		stored.Name = job.Name
+		stored.Labels = job.Labels
+		stored.UpdatedAt = time.Now()
+	})
+	if err == nil {
+		log.Println("[INFO-JobMan] Job updated. version:", updated.Version, job.ID)
+	}
+	return updated, err
+}
+
+// PauseJob keeps the job but assigns it to no member, which stops its worker.
+// Checkpoint and data of the job are kept for ResumeJob.
+func (manager *Manager) PauseJob(jobID string) error {
+	return manager.setPaused(jobID, true)
+}
+
+// ResumeJob lets a paused job be assigned again
+func (manager *Manager) ResumeJob(jobID string) error {
+	return manager.setPaused(jobID, false)
+}
+
+func (manager *Manager) setPaused(jobID string, paused bool) error {
+	_, err := manager.dao.UpdateJob(jobID, func(job *Job) {
+		if job.Paused == paused {
+			return
+		}
+		job.Paused = paused
+		job.UpdatedAt = time.Now()
+	})
+	if err == nil {
+		log.Println("[INFO-JobMan] Job paused:", paused, jobID)
+	}
+	return err
+}
+
+// SetPlacement sets placement constraints of a job. nil placement removes constraints.
+// The pin of the job is kept, PinnedTo of placement is ignored. Pins are set with PinJob.
+func (manager *Manager) SetPlacement(jobID string, placement *Placement) error {
+	return manager.dao.UpdatePlacement(jobID, func(current *Placement) {
+		pinnedTo := current.PinnedTo
+		*current = Placement{}
+		if placement != nil {
+			*current = *placement
+		}
+		current.PinnedTo = pinnedTo
+	})
+}
+
+// PinJob pins a job to the member, keeping placement constraints of the job. Empty membID unpins the job.
+func (manager *Manager) PinJob(jobID string, membID string) error {
+	err := manager.dao.UpdatePlacement(jobID, func(current *Placement) {
+		current.PinnedTo = membID
+	})
+	if err == nil {
+		log.Println("[INFO-JobMan] Job pinned:", jobID, "->", membID)
+	}
+	return err
+}
+
+// GetPlacement returns nil if the job has no placement
+func (manager *Manager) GetPlacement(jobID string) (placement *Placement, err error) {
+	return manager.dao.GetPlacement(jobID)
 }
 
 // RemoveJob ..
@@ -93,9 +294,27 @@ func (manager *Manager) GetAllMemberJobIDs() (membJobMap map[string][]string, er
 	return manager.dao.GetAllMemberJobIDs()
 }
 
-// SetMemberJobIDs ..
-func (manager *Manager) SetMemberJobIDs(membID string, jobIDs []string) (err error) {
-	return manager.dao.PutMemberJobs(membID, jobIDs)
+// SetMemberJobIDs writes jobs of a member, fenced by the election key and term of the leader.
+func (manager *Manager) SetMemberJobIDs(leaderKey string, term int64, membID string, jobIDs []string) (err error) {
+	if leaderKey == "" {
+		return ErrNotLeader
+	}
+	return manager.dao.PutMemberJobs(leaderKey, term, membID, jobIDs)
+}
+
+// SetAllMemberJobIDs writes all member jobs at once, fenced by the election key and term of the leader.
+// Jobs moving from an alive member are handed off, and assigned to the new member by ActivateHandoffs.
+// Fails with ErrNotLeader when local member lost leadership.
+func (manager *Manager) SetAllMemberJobIDs(leaderKey string, term int64, membJobMap map[string][]string,
+	aliveMembers []string) (err error) {
+	if leaderKey == "" {
+		return ErrNotLeader
+	}
+	assignments, handoffs, removed, err := manager.planHandoffs(membJobMap, aliveMembers)
+	if err != nil {
+		return err
+	}
+	return manager.dao.PutAllMemberJobs(leaderKey, term, assignments, handoffs, removed)
 }
 
 // GetMemberJobs ..
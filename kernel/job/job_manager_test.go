@@ -0,0 +1,79 @@
+package job
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
+)
+
+func TestResyncWhileDisposing(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+
+	for i := 0; i < 20; i++ {
+		manager := NewManager("c1", "A", store)
+		manager.Start()
+
+		wait := sync.WaitGroup{}
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			manager.resyncJobs()
+		}()
+		go func() {
+			defer wait.Done()
+			manager.resyncMemberJobs()
+		}()
+		manager.Dispose()
+		wait.Wait()
+
+		manager.watchMutex.Lock()
+		watchers := []*kv.Watcher{manager.jobWatcher, manager.membJobWatcher}
+		manager.watchMutex.Unlock()
+		for _, watcher := range watchers {
+			select {
+			case <-watcher.Done():
+			default:
+				t.Fatal("watcher is left running after Dispose")
+			}
+		}
+	}
+}
+
+func TestPinKeepsPlacement(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager := NewManager("c1", "A", store)
+
+	err := manager.SetPlacement("j1", &Placement{PreferredZone: "z1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.PinJob("j1", "A"); err != nil {
+		t.Fatal(err)
+	}
+	placement, err := manager.GetPlacement("j1")
+	if err != nil || placement == nil || placement.PreferredZone != "z1" || placement.PinnedTo != "A" {
+		t.Fatal("pin must keep placement constraints", placement, err)
+	}
+
+	// placement without pin keeps the pin
+	if err = manager.SetPlacement("j1", &Placement{AntiAffinity: "g1"}); err != nil {
+		t.Fatal(err)
+	}
+	placement, _ = manager.GetPlacement("j1")
+	if placement == nil || placement.AntiAffinity != "g1" || placement.PreferredZone != "" || placement.PinnedTo != "A" {
+		t.Fatal("placement must keep the pin", placement)
+	}
+
+	if err = manager.SetPlacement("j1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.PinJob("j1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if placement, _ = manager.GetPlacement("j1"); placement != nil {
+		t.Fatal("empty placement must be removed", placement)
+	}
+}
@@ -10,6 +10,32 @@ type Organizer interface {
 	Distribute(allJobs map[string]Job, aliveMembers []string, membJobMap map[string][]string) (membJobs map[string][]string, err error)
 }
 
+const (
+	// OrganizerSimple name of the organizer by NewSimpleOrganizer
+	OrganizerSimple = "simple"
+	// OrganizerPlacement name of the organizer by NewPlacementOrganizer
+	OrganizerPlacement = "placement"
+	// OrganizerRendezvous name of the organizer by NewRendezvousOrganizer with DefaultLoadFactor
+	OrganizerRendezvous = "rendezvous"
+	// OrganizerWeighted name of the organizer by NewWeightedOrganizer
+	OrganizerWeighted = "weighted"
+)
+
+// NewOrganizer returns the organizer of name. Empty name is OrganizerSimple.
+func NewOrganizer(name string) (organizer Organizer, err error) {
+	switch name {
+	case "", OrganizerSimple:
+		return NewSimpleOrganizer(), nil
+	case OrganizerPlacement:
+		return NewPlacementOrganizer(), nil
+	case OrganizerRendezvous:
+		return NewRendezvousOrganizer(DefaultLoadFactor), nil
+	case OrganizerWeighted:
+		return NewWeightedOrganizer(), nil
+	}
+	return nil, fmt.Errorf("Unknown job organizer %q", name)
+}
+
 type simpleOrganizer struct {
 }
 
@@ -0,0 +1,17 @@
+package job
+
+import (
+	"testing"
+)
+
+func TestNewOrganizer(t *testing.T) {
+	for _, name := range []string{"", OrganizerSimple, OrganizerPlacement, OrganizerRendezvous, OrganizerWeighted} {
+		organizer, err := NewOrganizer(name)
+		if err != nil || organizer == nil {
+			t.Fatal("cannot create organizer", name, err)
+		}
+	}
+	if _, err := NewOrganizer("unknown"); err == nil {
+		t.Fatal("unknown organizer must fail")
+	}
+}
@@ -0,0 +1,168 @@
+package job
+
+import "errors"
+
+// ErrNoMembers returned when there is no member to distribute jobs to
+var ErrNoMembers = errors.New("No member to distribute jobs")
+
+// Member : member metadata for placement of jobs
+type Member struct {
+	ID     string
+	Zone   string
+	Labels map[string]string
+	// Capacity max total weight of jobs of the member. Zero is unlimited.
+	Capacity int
+	// Cordoned member gets no new jobs, but keeps its jobs
+	Cordoned bool
+	// Load weight of jobs pinned to the member, which count to its capacity but are not organized
+	Load int
+}
+
+// MemberLoads returns total weight of jobs of each member
+func MemberLoads(allJobs map[string]Job, membJobMap map[string][]string) (loads map[string]int) {
+	loads = make(map[string]int)
+	for membID, jobIDs := range membJobMap {
+		loads[membID] = 0
+		for _, jobID := range jobIDs {
+			if job, ok := allJobs[jobID]; ok {
+				loads[membID] += job.Cost()
+			}
+		}
+	}
+	return loads
+}
+
+// HasLabels returns whether member has all labels
+func (memb *Member) HasLabels(labels map[string]string) bool {
+	for key, value := range labels {
+		if value2, ok := memb.Labels[key]; !ok || value2 != value {
+			return false
+		}
+	}
+	return true
+}
+
+// MemberOrganizer : Organizer distributing jobs with member metadata
+type MemberOrganizer interface {
+	Organizer
+	DistributeToMembers(allJobs map[string]Job, members []Member, membJobMap map[string][]string) (membJobs map[string][]string, err error)
+}
+
+// Distribute distributes jobs to members with organizer. MemberOrganizer gets member metadata,
+// and other organizers get member ids.
+// Paused jobs go to no member. Pinned jobs go to their members and cordoned members keep their jobs,
+// whatever the organizer does.
+// Load of pinned jobs is passed to MemberOrganizer with members.
+// Jobs pinned to inactive members, and jobs left when all members are cordoned, are reported by PlacementError.
+func Distribute(organizer Organizer, allJobs map[string]Job, members []Member,
+	membJobMap map[string][]string) (membJobs map[string][]string, err error) {
+	if len(members) == 0 {
+		return nil, ErrNoMembers
+	}
+
+	fixed := make(map[string][]string)
+	unplaced := make(map[string]string)
+	active := make(map[string]bool)
+	cordoned := make(map[string]bool)
+	organizerMembers := []Member{}
+	for _, memb := range members {
+		active[memb.ID] = true
+		fixed[memb.ID] = []string{}
+		if memb.Cordoned {
+			cordoned[memb.ID] = true
+		} else {
+			organizerMembers = append(organizerMembers, memb)
+		}
+	}
+
+	// 1) pinned jobs
+	pinnedLoads := make(map[string]int)
+	organizerJobs := make(map[string]Job)
+	for jobID, job := range allJobs {
+		if job.Paused {
+			continue
+		}
+		if job.Placement == nil || job.Placement.PinnedTo == "" {
+			organizerJobs[jobID] = job
+			continue
+		}
+		if active[job.Placement.PinnedTo] {
+			fixed[job.Placement.PinnedTo] = append(fixed[job.Placement.PinnedTo], jobID)
+			pinnedLoads[job.Placement.PinnedTo] += job.Cost()
+		} else {
+			unplaced[jobID] = "pinned member " + job.Placement.PinnedTo + " is not active"
+		}
+	}
+
+	// 2) cordoned members keep their jobs
+	organizerJobMap := make(map[string][]string)
+	for membID, jobIDs := range membJobMap {
+		if !cordoned[membID] {
+			organizerJobMap[membID] = jobIDs
+			continue
+		}
+		for _, jobID := range jobIDs {
+			if _, ok := organizerJobs[jobID]; ok {
+				fixed[membID] = append(fixed[membID], jobID)
+				delete(organizerJobs, jobID)
+			}
+		}
+	}
+	// jobs fixed above are not organized
+	for membID, jobIDs := range organizerJobMap {
+		kept := []string{}
+		for _, jobID := range jobIDs {
+			if _, ok := organizerJobs[jobID]; ok {
+				kept = append(kept, jobID)
+			}
+		}
+		organizerJobMap[membID] = kept
+	}
+
+	// 3) the organizer distributes other jobs to members which are not cordoned
+	membJobs = make(map[string][]string)
+	if len(organizerMembers) == 0 {
+		for jobID := range organizerJobs {
+			unplaced[jobID] = "all members are cordoned"
+		}
+	} else {
+		for i := range organizerMembers {
+			organizerMembers[i].Load += pinnedLoads[organizerMembers[i].ID]
+		}
+		var organized map[string][]string
+		if memberOrganizer, ok := organizer.(MemberOrganizer); ok {
+			organized, err = memberOrganizer.DistributeToMembers(organizerJobs, organizerMembers, organizerJobMap)
+		} else {
+			membIDs := make([]string, len(organizerMembers))
+			for i, memb := range organizerMembers {
+				membIDs[i] = memb.ID
+			}
+			organized, err = organizer.Distribute(organizerJobs, membIDs, organizerJobMap)
+		}
+		if placementErr, ok := err.(*PlacementError); ok {
+			for jobID, reason := range placementErr.Jobs {
+				unplaced[jobID] = reason
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		for membID, jobIDs := range organized {
+			membJobs[membID] = jobIDs
+		}
+	}
+
+	for membID, jobIDs := range fixed {
+		membJobs[membID] = append(jobIDs, membJobs[membID]...)
+	}
+	// jobs of inactive members are cleared
+	for membID := range membJobMap {
+		if membJobs[membID] == nil {
+			membJobs[membID] = []string{}
+		}
+	}
+
+	if len(unplaced) > 0 {
+		return membJobs, &PlacementError{Jobs: unplaced}
+	}
+	return membJobs, nil
+}
@@ -0,0 +1,242 @@
+package job
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// PlacementError : jobs which cannot be placed on any member, with the reasons
+type PlacementError struct {
+	Jobs map[string]string
+}
+
+func (err *PlacementError) Error() string {
+	jobIDs := []string{}
+	for jobID := range err.Jobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	sort.Strings(jobIDs)
+
+	reasons := []string{}
+	for _, jobID := range jobIDs {
+		reasons = append(reasons, jobID+": "+err.Jobs[jobID])
+	}
+	return fmt.Sprintf("%d jobs cannot be placed [%s]", len(jobIDs), strings.Join(reasons, ", "))
+}
+
+type placementOrganizer struct {
+}
+
+// NewPlacementOrganizer : Organizer placing jobs on members with required labels, running jobs of
+// a same anti-affinity group on different members, preferring zone of jobs and balancing weight of jobs
+// relative to capacity of members.
+// Jobs stay on their members while the constraints hold. Jobs which cannot be placed are reported
+// by PlacementError with the distribution of the other jobs.
+func NewPlacementOrganizer() MemberOrganizer {
+	return &placementOrganizer{}
+}
+
+// Distribute ..
+func (organizer *placementOrganizer) Distribute(
+	allJobs map[string]Job, aliveMembers []string, membJobMap map[string][]string) (membJobs map[string][]string, err error) {
+	members := make([]Member, len(aliveMembers))
+	for i, membID := range aliveMembers {
+		members[i] = Member{ID: membID}
+	}
+	return organizer.DistributeToMembers(allJobs, members, membJobMap)
+}
+
+// DistributeToMembers ..
+func (organizer *placementOrganizer) DistributeToMembers(
+	allJobs map[string]Job, members []Member, membJobMap map[string][]string) (membJobs map[string][]string, err error) {
+	if len(members) == 0 {
+		return nil, ErrNoMembers
+	}
+
+	totalWeight := 0
+	for _, job := range allJobs {
+		totalWeight += job.Cost()
+	}
+	for _, memb := range members {
+		totalWeight += memb.Load
+	}
+	placement := newPlacementState(members, totalWeight)
+
+	owners := make(map[string]string)
+	for membID, jobIDs := range membJobMap {
+		for _, jobID := range jobIDs {
+			owners[jobID] = membID
+		}
+	}
+
+	jobIDs := []string{}
+	for jobID := range allJobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	sort.Strings(jobIDs)
+
+	// 1) keep jobs on their members while constraints hold and members are under their fair share
+	unallocated := []string{}
+	for _, jobID := range jobIDs {
+		job := allJobs[jobID]
+		memb := placement.members[owners[jobID]]
+		if memb == nil || float64(placement.loads[memb.ID]) >= placement.shares[memb.ID] || !placement.fits(memb, job) ||
+			!placement.inPreferredZone(memb, job) {
+			unallocated = append(unallocated, jobID)
+			continue
+		}
+		placement.assign(memb, job)
+	}
+
+	// 2) place other jobs on members with the lowest load relative to their capacity
+	unplaced := make(map[string]string)
+	for _, jobID := range unallocated {
+		job := allJobs[jobID]
+		memb := placement.choose(job)
+		if memb == nil {
+			unplaced[jobID] = placement.reason(job)
+			log.Println("[WARN-PlacementOrganizer] Cannot place job ", jobID, unplaced[jobID])
+			continue
+		}
+		placement.assign(memb, job)
+	}
+
+	membJobs = make(map[string][]string)
+	for membID, jobIDs := range placement.jobs {
+		membJobs[membID] = jobIDs
+	}
+	// jobs of inactive members are cleared
+	for membID := range membJobMap {
+		if membJobs[membID] == nil {
+			membJobs[membID] = []string{}
+		}
+	}
+
+	log.Println("[INFO-PlacementOrganizer] all jobs:", len(allJobs), ", unplaced jobs:", len(unplaced))
+
+	if len(unplaced) > 0 {
+		return membJobs, &PlacementError{Jobs: unplaced}
+	}
+	return membJobs, nil
+}
+
+// placementState : jobs and anti-affinity groups of members while organizing
+type placementState struct {
+	memberIDs []string
+	members   map[string]*Member
+	jobs      map[string][]string
+	loads     map[string]int
+	shares    map[string]float64
+	groups    map[string]map[string]bool
+}
+
+func newPlacementState(members []Member, totalWeight int) *placementState {
+	state := placementState{memberIDs: []string{}, members: make(map[string]*Member),
+		jobs: make(map[string][]string), loads: make(map[string]int), shares: fairShares(members, totalWeight),
+		groups: make(map[string]map[string]bool)}
+	for i := range members {
+		memb := &members[i]
+		state.memberIDs = append(state.memberIDs, memb.ID)
+		state.members[memb.ID] = memb
+		state.jobs[memb.ID] = []string{}
+		state.loads[memb.ID] = memb.Load
+		state.groups[memb.ID] = make(map[string]bool)
+	}
+	sort.Strings(state.memberIDs)
+	return &state
+}
+
+func (state *placementState) assign(memb *Member, job Job) {
+	state.jobs[memb.ID] = append(state.jobs[memb.ID], job.ID)
+	state.loads[memb.ID] += job.Cost()
+	if job.Placement != nil && job.Placement.AntiAffinity != "" {
+		state.groups[memb.ID][job.Placement.AntiAffinity] = true
+	}
+}
+
+// fits returns whether memb has required labels, room for the job and no job of its anti-affinity group
+func (state *placementState) fits(memb *Member, job Job) bool {
+	if memb.Capacity > 0 && state.loads[memb.ID]+job.Cost() > memb.Capacity {
+		return false
+	}
+	if job.Placement == nil {
+		return true
+	}
+	if !memb.HasLabels(job.Placement.RequiredLabels) {
+		return false
+	}
+	return job.Placement.AntiAffinity == "" || !state.groups[memb.ID][job.Placement.AntiAffinity]
+}
+
+// inPreferredZone returns false if memb is out of preferred zone of the job, and a member in the zone fits
+func (state *placementState) inPreferredZone(memb *Member, job Job) bool {
+	if job.Placement == nil || job.Placement.PreferredZone == "" || memb.Zone == job.Placement.PreferredZone {
+		return true
+	}
+	for _, membID := range state.memberIDs {
+		memb2 := state.members[membID]
+		if memb2.Zone == job.Placement.PreferredZone && state.fits(memb2, job) {
+			return false
+		}
+	}
+	return true
+}
+
+// choose returns the member to place the job, members in preferred zone first and then
+// the lowest weight of jobs relative to fair share of the member
+func (state *placementState) choose(job Job) (chosen *Member) {
+	zone := ""
+	if job.Placement != nil {
+		zone = job.Placement.PreferredZone
+	}
+
+	for _, membID := range state.memberIDs {
+		memb := state.members[membID]
+		if !state.fits(memb, job) {
+			continue
+		}
+		if chosen == nil {
+			chosen = memb
+			continue
+		}
+		inZone, chosenInZone := zone != "" && memb.Zone == zone, zone != "" && chosen.Zone == zone
+		if inZone != chosenInZone {
+			if inZone {
+				chosen = memb
+			}
+			continue
+		}
+		if state.relativeLoad(memb, job) < state.relativeLoad(chosen, job) {
+			chosen = memb
+		}
+	}
+	return chosen
+}
+
+// relativeLoad returns load of memb with the job, relative to fair share of memb
+func (state *placementState) relativeLoad(memb *Member, job Job) float64 {
+	return float64(state.loads[memb.ID]+job.Cost()) / state.shares[memb.ID]
+}
+
+// reason tells why the job cannot be placed
+func (state *placementState) reason(job Job) string {
+	if job.Placement != nil {
+		labeled := false
+		for _, membID := range state.memberIDs {
+			if state.members[membID].HasLabels(job.Placement.RequiredLabels) {
+				labeled = true
+				break
+			}
+		}
+		if !labeled {
+			return fmt.Sprint("no member has labels ", job.Placement.RequiredLabels)
+		}
+		if job.Placement.AntiAffinity != "" {
+			return "members with required labels are full or run jobs of anti-affinity group " +
+				job.Placement.AntiAffinity
+		}
+	}
+	return "members are full"
+}
@@ -0,0 +1,99 @@
+package job
+
+import (
+	"testing"
+)
+
+func TestPlacementBalancesWeight(t *testing.T) {
+	allJobs := map[string]Job{
+		"j1": {ID: "j1", Weight: 3},
+		"j2": {ID: "j2"},
+		"j3": {ID: "j3"},
+		"j4": {ID: "j4"},
+	}
+	members := []Member{{ID: "m1"}, {ID: "m2"}}
+
+	membJobs, err := NewPlacementOrganizer().DistributeToMembers(allJobs, members, map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loads := MemberLoads(allJobs, membJobs)
+	if loads["m1"] != 3 || loads["m2"] != 3 {
+		t.Fatal("weight is not balanced", membJobs)
+	}
+}
+
+func TestPlacementBalancesByCapacity(t *testing.T) {
+	allJobs := map[string]Job{}
+	for _, jobID := range []string{"j1", "j2", "j3", "j4", "j5", "j6"} {
+		allJobs[jobID] = Job{ID: jobID}
+	}
+	members := []Member{{ID: "m1", Capacity: 4}, {ID: "m2", Capacity: 2}}
+
+	membJobs, err := NewPlacementOrganizer().DistributeToMembers(allJobs, members, map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(membJobs["m1"]) != 4 || len(membJobs["m2"]) != 2 {
+		t.Fatal("jobs are not balanced by capacity", membJobs)
+	}
+}
+
+func TestPlacementConstraints(t *testing.T) {
+	allJobs := map[string]Job{
+		"gpu":  {ID: "gpu", Placement: &Placement{RequiredLabels: map[string]string{"class": "gpu"}}},
+		"a1":   {ID: "a1", Placement: &Placement{AntiAffinity: "a"}},
+		"a2":   {ID: "a2", Placement: &Placement{AntiAffinity: "a"}},
+		"zone": {ID: "zone", Placement: &Placement{PreferredZone: "z2"}},
+		"none": {ID: "none", Placement: &Placement{RequiredLabels: map[string]string{"class": "tpu"}}},
+	}
+	members := []Member{
+		{ID: "m1", Zone: "z1", Labels: map[string]string{"class": "gpu"}},
+		{ID: "m2", Zone: "z2"},
+	}
+
+	membJobs, err := NewPlacementOrganizer().DistributeToMembers(allJobs, members, map[string][]string{})
+	placementErr, ok := err.(*PlacementError)
+	if !ok || len(placementErr.Jobs) != 1 || placementErr.Jobs["none"] == "" {
+		t.Fatal("job without labeled member must be reported", err)
+	}
+
+	owners := make(map[string]string)
+	for membID, jobIDs := range membJobs {
+		for _, jobID := range jobIDs {
+			owners[jobID] = membID
+		}
+	}
+	if owners["gpu"] != "m1" {
+		t.Fatal("job is placed on member without required labels", membJobs)
+	}
+	if owners["a1"] == owners["a2"] {
+		t.Fatal("jobs of anti-affinity group run on a same member", membJobs)
+	}
+	if owners["zone"] != "m2" {
+		t.Fatal("job is not placed in preferred zone", membJobs)
+	}
+}
+
+func TestPlacementKeepsJobs(t *testing.T) {
+	allJobs := map[string]Job{}
+	current := map[string][]string{"m1": {}, "m2": {}}
+	for i, jobID := range []string{"j1", "j2", "j3", "j4", "j5", "j6"} {
+		allJobs[jobID] = Job{ID: jobID}
+		membID := "m1"
+		if i%2 == 1 {
+			membID = "m2"
+		}
+		current[membID] = append(current[membID], jobID)
+	}
+	members := []Member{{ID: "m1"}, {ID: "m2"}, {ID: "m3"}}
+
+	membJobs, err := NewPlacementOrganizer().DistributeToMembers(allJobs, members, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := NewPlan(allJobs, current, membJobs).Moves
+	if len(moved) != 2 || len(membJobs["m3"]) != 2 {
+		t.Fatal("only jobs over fair share should move to the new member", membJobs)
+	}
+}
@@ -0,0 +1,117 @@
+package job
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrStalePlan returned when jobs or member jobs changed since the plan was made
+var ErrStalePlan = errors.New("Member jobs changed since the plan was made")
+
+// ErrInvalidPlan returned when a plan assigns jobs to inactive or cordoned members, or away from pinned members
+var ErrInvalidPlan = errors.New("Plan assigns jobs against members, cordons or pins")
+
+// Move : a job moving From a member To another member. From is empty for an unassigned job,
+// and To is empty for a job which cannot be placed.
+type Move struct {
+	Job  string `json:"job"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Plan : distribution of jobs by an organizer, not yet written
+type Plan struct {
+	Moves       []Move              `json:"moves"`
+	Assignments map[string][]string `json:"assignments"`
+	Loads       map[string]int      `json:"loads"`
+	Unplaced    map[string]string   `json:"unplaced,omitempty"`
+}
+
+// NewPlan compares assignments with current member jobs
+func NewPlan(allJobs map[string]Job, current map[string][]string, assignments map[string][]string) *Plan {
+	plan := Plan{Moves: []Move{}, Assignments: assignments, Loads: MemberLoads(allJobs, assignments)}
+
+	from := owners(current)
+	to := owners(assignments)
+
+	jobIDs := []string{}
+	for jobID := range allJobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	sort.Strings(jobIDs)
+
+	for _, jobID := range jobIDs {
+		if from[jobID] != to[jobID] {
+			plan.Moves = append(plan.Moves, Move{Job: jobID, From: from[jobID], To: to[jobID]})
+		}
+	}
+	return &plan
+}
+
+// Check returns ErrStalePlan unless the plan assigns each job of allJobs which is not paused, or reports it
+// unplaced, and its moves are the changes from current member jobs to its assignments.
+// ErrInvalidPlan is returned if it assigns jobs to members which are not active, moves jobs to cordoned
+// members, or assigns pinned jobs to other members.
+func (plan *Plan) Check(allJobs map[string]Job, current map[string][]string, members []Member) error {
+	planned := make(map[string]bool)
+	for _, jobIDs := range plan.Assignments {
+		for _, jobID := range jobIDs {
+			if job, ok := allJobs[jobID]; !ok || job.Paused || planned[jobID] {
+				return ErrStalePlan
+			}
+			planned[jobID] = true
+		}
+	}
+	for jobID := range plan.Unplaced {
+		if _, ok := allJobs[jobID]; !ok || planned[jobID] {
+			return ErrStalePlan
+		}
+		planned[jobID] = true
+	}
+	for jobID, job := range allJobs {
+		if !job.Paused && !planned[jobID] {
+			return ErrStalePlan
+		}
+	}
+
+	moves := NewPlan(allJobs, current, plan.Assignments).Moves
+	if len(moves) != len(plan.Moves) {
+		return ErrStalePlan
+	}
+	for i, move := range moves {
+		if plan.Moves[i] != move {
+			return ErrStalePlan
+		}
+	}
+
+	active := make(map[string]Member)
+	for _, memb := range members {
+		active[memb.ID] = memb
+	}
+	to := owners(plan.Assignments)
+	for jobID, membID := range to {
+		if _, ok := active[membID]; !ok {
+			return ErrInvalidPlan
+		}
+		if placement := allJobs[jobID].Placement; placement != nil && placement.PinnedTo != "" &&
+			placement.PinnedTo != membID {
+			return ErrInvalidPlan
+		}
+	}
+	for _, move := range moves {
+		if move.To != "" && active[move.To].Cordoned {
+			return ErrInvalidPlan
+		}
+	}
+	return nil
+}
+
+func owners(membJobMap map[string][]string) map[string]string {
+	owners := make(map[string]string)
+	for membID, jobIDs := range membJobMap {
+		for _, jobID := range jobIDs {
+			owners[jobID] = membID
+		}
+	}
+	return owners
+}
@@ -0,0 +1,67 @@
+package job
+
+import (
+	"testing"
+)
+
+func TestPlanCheck(t *testing.T) {
+	allJobs := map[string]Job{
+		"j1": {ID: "j1"},
+		"j2": {ID: "j2"},
+		"j3": {ID: "j3", Placement: &Placement{PinnedTo: "A"}},
+		"j4": {ID: "j4", Paused: true},
+	}
+	current := map[string][]string{"A": {"j1", "j3"}, "B": {"j2"}}
+	members := []Member{{ID: "A"}, {ID: "B"}, {ID: "C", Cordoned: true}}
+
+	check := func(assignments map[string][]string) error {
+		return NewPlan(allJobs, current, assignments).Check(allJobs, current, members)
+	}
+
+	if err := check(map[string][]string{"A": {"j3"}, "B": {"j1", "j2"}}); err != nil {
+		t.Fatal("valid plan", err)
+	}
+
+	// job set differs from current jobs
+	if err := check(map[string][]string{"A": {"j3"}, "B": {"j2"}}); err != ErrStalePlan {
+		t.Fatal("plan dropping a job", err)
+	}
+	if err := check(map[string][]string{"A": {"j1", "j3", "j4"}, "B": {"j2"}}); err != ErrStalePlan {
+		t.Fatal("plan assigning a paused job", err)
+	}
+	if err := check(map[string][]string{"A": {"j1", "j3", "j5"}, "B": {"j2"}}); err != ErrStalePlan {
+		t.Fatal("plan assigning a removed job", err)
+	}
+	if err := check(map[string][]string{"A": {"j1", "j3"}, "B": {"j1", "j2"}}); err != ErrStalePlan {
+		t.Fatal("plan assigning a job twice", err)
+	}
+
+	// member jobs changed since the plan was made
+	plan := NewPlan(allJobs, current, map[string][]string{"A": {"j3"}, "B": {"j1", "j2"}})
+	changed := map[string][]string{"A": {"j3"}, "B": {"j1", "j2"}}
+	if err := plan.Check(allJobs, changed, members); err != ErrStalePlan {
+		t.Fatal("plan on changed member jobs", err)
+	}
+	// moves must be the changes of assignments
+	plan.Assignments = map[string][]string{"A": {"j1", "j3"}, "B": {"j2"}}
+	if err := plan.Check(allJobs, current, members); err != ErrStalePlan {
+		t.Fatal("plan with assignments other than its moves", err)
+	}
+
+	if err := check(map[string][]string{"A": {"j1", "j3"}, "D": {"j2"}}); err != ErrInvalidPlan {
+		t.Fatal("plan assigning to inactive member", err)
+	}
+	if err := check(map[string][]string{"A": {"j1", "j3"}, "C": {"j2"}}); err != ErrInvalidPlan {
+		t.Fatal("plan moving to cordoned member", err)
+	}
+	if err := check(map[string][]string{"A": {"j1"}, "B": {"j2", "j3"}}); err != ErrInvalidPlan {
+		t.Fatal("plan moving a pinned job", err)
+	}
+
+	// cordoned members keep their jobs
+	current["C"] = []string{"j2"}
+	current["B"] = []string{}
+	if err := check(map[string][]string{"A": {"j1", "j3"}, "C": {"j2"}}); err != nil {
+		t.Fatal("plan keeping jobs of cordoned member", err)
+	}
+}
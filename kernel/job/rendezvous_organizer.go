@@ -0,0 +1,130 @@
+package job
+
+import (
+	"hash/fnv"
+	"log"
+	"math"
+	"sort"
+)
+
+// DefaultLoadFactor members get at most 25% more jobs than average
+const DefaultLoadFactor = 1.25
+
+type rendezvousOrganizer struct {
+	loadFactor float64
+}
+
+// NewRendezvousOrganizer : Organizer placing each job on the member with the highest hash of job and member
+// (rendezvous hashing), so a member joining or leaving moves about 1/N of jobs.
+// Members get at most loadFactor times the average number of jobs, and jobs over the bound
+// go to the next member in the order of hash. Results depend only on jobs and members.
+func NewRendezvousOrganizer(loadFactor float64) MemberOrganizer {
+	if loadFactor < 1 {
+		loadFactor = DefaultLoadFactor
+	}
+	return &rendezvousOrganizer{loadFactor: loadFactor}
+}
+
+// Distribute ..
+func (organizer *rendezvousOrganizer) Distribute(
+	allJobs map[string]Job, aliveMembers []string, membJobMap map[string][]string) (membJobs map[string][]string, err error) {
+	members := make([]Member, len(aliveMembers))
+	for i, membID := range aliveMembers {
+		members[i] = Member{ID: membID}
+	}
+	return organizer.DistributeToMembers(allJobs, members, membJobMap)
+}
+
+// DistributeToMembers .. Capacity of members bounds weight of their jobs and pinned load too.
+func (organizer *rendezvousOrganizer) DistributeToMembers(
+	allJobs map[string]Job, members []Member, membJobMap map[string][]string) (membJobs map[string][]string, err error) {
+	if len(members) == 0 {
+		return nil, ErrNoMembers
+	}
+
+	bound := int(math.Ceil(float64(len(allJobs)) / float64(len(members)) * organizer.loadFactor))
+	if bound < 1 {
+		bound = 1
+	}
+
+	jobIDs := []string{}
+	for jobID := range allJobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	sort.Strings(jobIDs)
+
+	membJobs = make(map[string][]string)
+	loads := make(map[string]int)
+	for _, memb := range members {
+		membJobs[memb.ID] = []string{}
+		loads[memb.ID] = memb.Load
+	}
+
+	unplaced := make(map[string]string)
+	for _, jobID := range jobIDs {
+		job := allJobs[jobID]
+		placed := false
+		for _, memb := range rankMembers(jobID, members) {
+			if len(membJobs[memb.ID]) >= bound || (memb.Capacity > 0 && loads[memb.ID]+job.Cost() > memb.Capacity) {
+				continue
+			}
+			membJobs[memb.ID] = append(membJobs[memb.ID], jobID)
+			loads[memb.ID] += job.Cost()
+			placed = true
+			break
+		}
+		if !placed {
+			unplaced[jobID] = "members are full"
+		}
+	}
+
+	// jobs of inactive members are cleared
+	for membID := range membJobMap {
+		if membJobs[membID] == nil {
+			membJobs[membID] = []string{}
+		}
+	}
+
+	log.Println("[INFO-RendezvousOrganizer] all jobs:", len(allJobs), ", bound:", bound, ", unplaced jobs:", len(unplaced))
+
+	if len(unplaced) > 0 {
+		return membJobs, &PlacementError{Jobs: unplaced}
+	}
+	return membJobs, nil
+}
+
+// rankMembers sorts members by hash of job and member, highest first
+func rankMembers(jobID string, members []Member) []Member {
+	ranked := make([]Member, len(members))
+	copy(ranked, members)
+	scores := make(map[string]uint64)
+	for _, memb := range ranked {
+		scores[memb.ID] = rendezvousHash(jobID, memb.ID)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		score1, score2 := scores[ranked[i].ID], scores[ranked[j].ID]
+		if score1 != score2 {
+			return score1 > score2
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked
+}
+
+func rendezvousHash(jobID string, membID string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(jobID))
+	hash.Write([]byte{0})
+	hash.Write([]byte(membID))
+	return mix64(hash.Sum64())
+}
+
+// mix64 spreads bits of fnv hash, which differs little for similar inputs
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
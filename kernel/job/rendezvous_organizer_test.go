@@ -0,0 +1,91 @@
+package job
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func rendezvousJobs(count int) map[string]Job {
+	allJobs := make(map[string]Job)
+	for i := 0; i < count; i++ {
+		jobID := fmt.Sprintf("job-%03d", i)
+		allJobs[jobID] = Job{ID: jobID}
+	}
+	return allJobs
+}
+
+func rendezvousMembers(count int) []Member {
+	members := []Member{}
+	for i := 0; i < count; i++ {
+		members = append(members, Member{ID: fmt.Sprintf("memb-%d", i)})
+	}
+	return members
+}
+
+func sortedMemberJobs(membJobs map[string][]string) map[string][]string {
+	for _, jobIDs := range membJobs {
+		sort.Strings(jobIDs)
+	}
+	return membJobs
+}
+
+func TestRendezvousIgnoresOrder(t *testing.T) {
+	allJobs := rendezvousJobs(100)
+	members := rendezvousMembers(5)
+	organizer := NewRendezvousOrganizer(DefaultLoadFactor)
+
+	expected, err := organizer.DistributeToMembers(allJobs, members, map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = sortedMemberJobs(expected)
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		shuffled := append([]Member{}, members...)
+		random.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		// current assignments must not change the result either
+		current := map[string][]string{shuffled[0].ID: {"job-001", "job-002"}}
+
+		membJobs, err := organizer.DistributeToMembers(allJobs, shuffled, current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(sortedMemberJobs(membJobs), expected) {
+			t.Fatal("distribution depends on order of members", membJobs, expected)
+		}
+	}
+}
+
+func TestRendezvousMovesFewJobs(t *testing.T) {
+	allJobs := rendezvousJobs(1000)
+	organizer := NewRendezvousOrganizer(DefaultLoadFactor)
+
+	before, err := organizer.DistributeToMembers(allJobs, rendezvousMembers(10), map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a member joins : about 1/11 of jobs move to it
+	joined, err := organizer.DistributeToMembers(allJobs, rendezvousMembers(11), before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := len(NewPlan(allJobs, before, joined).Moves)
+	if moves > 1000*3/(2*11) {
+		t.Fatal("too many jobs move when a member joins", moves)
+	}
+
+	// a member leaves : about its 1/10 of jobs move
+	left, err := organizer.DistributeToMembers(allJobs, rendezvousMembers(9), before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves = len(NewPlan(allJobs, before, left).Moves)
+	if moves > 1000*3/(2*10) {
+		t.Fatal("too many jobs move when a member leaves", moves)
+	}
+}
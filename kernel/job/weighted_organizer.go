@@ -0,0 +1,166 @@
+package job
+
+import (
+	"log"
+	"sort"
+)
+
+type weightedOrganizer struct {
+}
+
+// NewWeightedOrganizer : Organizer balancing total weight of jobs, packing heavy jobs first on
+// the member with the lowest load relative to its capacity. Jobs stay on their members while
+// the members are under their fair share and capacity. Jobs which fit no member are reported by PlacementError.
+func NewWeightedOrganizer() MemberOrganizer {
+	return &weightedOrganizer{}
+}
+
+// Distribute ..
+func (organizer *weightedOrganizer) Distribute(
+	allJobs map[string]Job, aliveMembers []string, membJobMap map[string][]string) (membJobs map[string][]string, err error) {
+	members := make([]Member, len(aliveMembers))
+	for i, membID := range aliveMembers {
+		members[i] = Member{ID: membID}
+	}
+	return organizer.DistributeToMembers(allJobs, members, membJobMap)
+}
+
+// DistributeToMembers ..
+func (organizer *weightedOrganizer) DistributeToMembers(
+	allJobs map[string]Job, members []Member, membJobMap map[string][]string) (membJobs map[string][]string, err error) {
+	if len(members) == 0 {
+		return nil, ErrNoMembers
+	}
+
+	// heavy jobs first
+	jobIDs := []string{}
+	totalWeight := 0
+	for jobID, job := range allJobs {
+		jobIDs = append(jobIDs, jobID)
+		totalWeight += job.Cost()
+	}
+	for _, memb := range members {
+		totalWeight += memb.Load
+	}
+	sort.Slice(jobIDs, func(i, j int) bool {
+		job1, job2 := allJobs[jobIDs[i]], allJobs[jobIDs[j]]
+		if job1.Cost() != job2.Cost() {
+			return job1.Cost() > job2.Cost()
+		}
+		return jobIDs[i] < jobIDs[j]
+	})
+
+	shares := fairShares(members, totalWeight)
+	loads := make(map[string]int)
+	membJobs = make(map[string][]string)
+	membByID := make(map[string]*Member)
+	for i := range members {
+		membJobs[members[i].ID] = []string{}
+		membByID[members[i].ID] = &members[i]
+		loads[members[i].ID] = members[i].Load
+	}
+
+	owners := make(map[string]string)
+	for membID, jobIDs := range membJobMap {
+		for _, jobID := range jobIDs {
+			owners[jobID] = membID
+		}
+	}
+
+	fits := func(memb *Member, job Job) bool {
+		return memb.Capacity <= 0 || loads[memb.ID]+job.Cost() <= memb.Capacity
+	}
+	assign := func(memb *Member, job Job) {
+		membJobs[memb.ID] = append(membJobs[memb.ID], job.ID)
+		loads[memb.ID] += job.Cost()
+	}
+
+	// 1) keep jobs on their members under the fair share
+	unallocated := []string{}
+	for _, jobID := range jobIDs {
+		job := allJobs[jobID]
+		memb := membByID[owners[jobID]]
+		if memb == nil || !fits(memb, job) || float64(loads[memb.ID]) >= shares[memb.ID] {
+			unallocated = append(unallocated, jobID)
+			continue
+		}
+		assign(memb, job)
+	}
+
+	// 2) pack other jobs on the member with the lowest relative load
+	unplaced := make(map[string]string)
+	for _, jobID := range unallocated {
+		job := allJobs[jobID]
+		var chosen *Member
+		chosenRatio := 0.0
+		for i := range members {
+			memb := &members[i]
+			if !fits(memb, job) {
+				continue
+			}
+			ratio := float64(loads[memb.ID]+job.Cost()) / shares[memb.ID]
+			if chosen == nil || ratio < chosenRatio || (ratio == chosenRatio && memb.ID < chosen.ID) {
+				chosen, chosenRatio = memb, ratio
+			}
+		}
+		if chosen == nil {
+			unplaced[jobID] = "members are full"
+			log.Println("[WARN-WeightedOrganizer] Cannot place job ", jobID, ", weight:", job.Cost())
+			continue
+		}
+		assign(chosen, job)
+	}
+
+	// jobs of inactive members are cleared
+	for membID := range membJobMap {
+		if membJobs[membID] == nil {
+			membJobs[membID] = []string{}
+		}
+	}
+
+	log.Println("[INFO-WeightedOrganizer] total weight:", totalWeight, ", loads:", loads, ", unplaced jobs:", len(unplaced))
+
+	if len(unplaced) > 0 {
+		return membJobs, &PlacementError{Jobs: unplaced}
+	}
+	return membJobs, nil
+}
+
+// fairShares divides total weight to members in proportion to their capacities.
+// Members of unlimited capacity count as the average capacity.
+func fairShares(members []Member, totalWeight int) (shares map[string]float64) {
+	sumCapacity, limited := 0, 0
+	for _, memb := range members {
+		if memb.Capacity > 0 {
+			sumCapacity += memb.Capacity
+			limited++
+		}
+	}
+	average := 1.0
+	if limited > 0 {
+		average = float64(sumCapacity) / float64(limited)
+	}
+
+	sum := 0.0
+	for _, memb := range members {
+		if memb.Capacity > 0 {
+			sum += float64(memb.Capacity)
+		} else {
+			sum += average
+		}
+	}
+
+	shares = make(map[string]float64)
+	for _, memb := range members {
+		capacity := average
+		if memb.Capacity > 0 {
+			capacity = float64(memb.Capacity)
+		}
+		share := float64(totalWeight) * capacity / sum
+		if share < 1 {
+			share = 1
+		}
+		shares[memb.ID] = share
+	}
+	return shares
+}
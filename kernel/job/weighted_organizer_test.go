@@ -0,0 +1,70 @@
+package job
+
+import (
+	"testing"
+)
+
+func TestWeightedPacksByCapacity(t *testing.T) {
+	allJobs := map[string]Job{
+		"heavy": {ID: "heavy", Weight: 4},
+		"j1":    {ID: "j1", Weight: 2},
+		"j2":    {ID: "j2"},
+		"j3":    {ID: "j3"},
+		"j4":    {ID: "j4"},
+	}
+	members := []Member{{ID: "m1", Capacity: 6}, {ID: "m2", Capacity: 3}}
+
+	membJobs, err := NewWeightedOrganizer().DistributeToMembers(allJobs, members, map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loads := MemberLoads(allJobs, membJobs)
+	if loads["m1"] != 6 || loads["m2"] != 3 {
+		t.Fatal("weight is not packed by capacity", membJobs, loads)
+	}
+}
+
+func TestWeightedReportsUnplaced(t *testing.T) {
+	allJobs := map[string]Job{
+		"huge": {ID: "huge", Weight: 5},
+		"j1":   {ID: "j1"},
+	}
+	members := []Member{{ID: "m1", Capacity: 2}}
+
+	membJobs, err := NewWeightedOrganizer().DistributeToMembers(allJobs, members, map[string][]string{})
+	placementErr, ok := err.(*PlacementError)
+	if !ok || len(placementErr.Jobs) != 1 || placementErr.Jobs["huge"] == "" {
+		t.Fatal("job over capacity must be reported", err)
+	}
+	if len(membJobs["m1"]) != 1 || membJobs["m1"][0] != "j1" {
+		t.Fatal("other jobs must be distributed", membJobs)
+	}
+}
+
+func TestWeightedCountsPinnedLoad(t *testing.T) {
+	allJobs := map[string]Job{
+		"pinned": {ID: "pinned", Weight: 4, Placement: &Placement{PinnedTo: "m1"}},
+		"j1":     {ID: "j1", Weight: 2},
+		"j2":     {ID: "j2", Weight: 2},
+	}
+	members := []Member{{ID: "m1"}, {ID: "m2"}}
+
+	membJobs, err := Distribute(NewWeightedOrganizer(), allJobs, members, map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(membJobs["m1"]) != 1 || membJobs["m1"][0] != "pinned" {
+		t.Fatal("jobs must go to the member without pinned load", membJobs)
+	}
+	if len(membJobs["m2"]) != 2 {
+		t.Fatal("jobs must be balanced with pinned load", membJobs)
+	}
+
+	// pinned load counts to capacity
+	members = []Member{{ID: "m1", Capacity: 5}}
+	_, err = Distribute(NewWeightedOrganizer(), allJobs, members, map[string][]string{})
+	placementErr, ok := err.(*PlacementError)
+	if !ok || len(placementErr.Jobs) != 2 {
+		t.Fatal("jobs over capacity with pinned load must be reported", err)
+	}
+}
@@ -0,0 +1,62 @@
+package kernel
+
+import (
+	"github.com/rhizomata/bridge-chain-etcd/kernel/worker"
+)
+
+// JobStatuses returns statuses of all jobs. Paused jobs released by their owners are paused, other jobs
+// assigned to no member are pending, and jobs whose owner has not written status yet are assigned.
+// Statuses written by previous owners are stopped, and are not shown while the job is assigned.
+func (kernel *Kernel) JobStatuses() (statuses map[string]worker.JobStatus, err error) {
+	allJobs, err := kernel.jobManager.GetAllJobs()
+	if err != nil {
+		return nil, err
+	}
+	membJobMap, err := kernel.jobManager.GetAllMemberJobIDs()
+	if err != nil {
+		return nil, err
+	}
+	written, err := kernel.workerManager.GetJobStatuses()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[string]string)
+	for membID, ids := range membJobMap {
+		for _, jobID := range ids {
+			owners[jobID] = membID
+		}
+	}
+
+	statuses = make(map[string]worker.JobStatus)
+	for jobID, j := range allJobs {
+		owner := owners[jobID]
+		status, ok := written[jobID]
+		switch {
+		case owner == "" && j.Paused:
+			status.State = worker.JobPaused
+			status.Owner = ""
+		case owner == "":
+			status = worker.JobStatus{State: worker.JobPending}
+		case !ok || status.Owner != owner:
+			status = worker.JobStatus{State: worker.JobAssigned, Owner: owner}
+		case status.State == worker.JobStopped:
+			// released and assigned again, but not started yet
+			status.State = worker.JobAssigned
+		}
+		statuses[jobID] = status
+	}
+	return statuses, nil
+}
+
+// JobStatus returns status of the job
+func (kernel *Kernel) JobStatus(jobID string) (status worker.JobStatus, err error) {
+	if _, err = kernel.jobManager.GetJob(jobID); err != nil {
+		return status, err
+	}
+	statuses, err := kernel.JobStatuses()
+	if err != nil {
+		return status, err
+	}
+	return statuses[jobID], nil
+}
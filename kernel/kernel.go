@@ -2,11 +2,14 @@ package kernel
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rhizomata/bridge-chain-etcd/kernel/cluster"
@@ -16,6 +19,14 @@ import (
 	"github.com/rhizomata/bridge-chain-etcd/kernel/worker"
 )
 
+// ErrNoJobOrganizer returned when jobs are organized before JobOrganizer is set
+var ErrNoJobOrganizer = errors.New("JobOrganizer is not set")
+
+// ErrDrainTimeout returned when workers are still running after drain timeout
+var ErrDrainTimeout = errors.New("Workers are still running after drain timeout")
+
+const drainCheckInterval = 200 * time.Millisecond
+
 const (
 	fileNameKernelID = ".kernel"
 )
@@ -25,21 +36,33 @@ type Kernel struct {
 	config            *model.Config
 	id                string
 	kv                kv.KV
+	etcdServer        *kv.EmbeddedEtcd
 	clusterManager    *cluster.Manager
 	jobManager        *job.Manager
 	jobOrganizer      job.Organizer
 	workerManager     *worker.Manager
 	rootWorkerFactory *worker.AbstractWorkerFactory
+	running           bool
+	// stateMutex guards state, and the cluster and job managers which Stop releases
+	stateMutex sync.RWMutex
+	state      State
+	stateSince time.Time
+	// done is closed by Stop to stop goroutines of the kernel, and routines waits for them
+	done     chan struct{}
+	routines sync.WaitGroup
 }
 
-// New ..
-func New(config *model.Config) *Kernel {
+// New .. Returns error when the local kernel id or KV store cannot be initialized.
+func New(config *model.Config) (*Kernel, error) {
 	kernel := new(Kernel)
 	kernel.config = config
+	kernel.stateSince = time.Now()
 	workerFactory := worker.NewAbstractWorkerFactory("_root")
 	kernel.rootWorkerFactory = workerFactory
-	kernel.initialize(workerFactory)
-	return kernel
+	if err := kernel.initialize(workerFactory); err != nil {
+		return nil, err
+	}
+	return kernel, nil
 }
 
 //RegisterWorkerFactory register worker.Factory
@@ -52,19 +75,21 @@ func (kernel *Kernel) SetJobOrganizer(jobOrganizer job.Organizer) {
 	kernel.jobOrganizer = jobOrganizer
 }
 
-func (kernel *Kernel) initialize(workerFactory worker.Factory) {
+func (kernel *Kernel) initialize(workerFactory worker.Factory) error {
 	if _, err := os.Stat(kernel.config.DataDir); err != nil {
 		if os.IsNotExist(err) {
 			os.MkdirAll(kernel.config.DataDir, os.ModePerm)
 		} else {
-			log.Fatal("[FATAL] Read local kernel data directory::", kernel.config.DataDir, err)
+			log.Println("[ERROR-Kernel] Read local kernel data directory::", kernel.config.DataDir, err)
+			return err
 		}
 	}
 	localFilePath := filepath.Join(kernel.config.DataDir, fileNameKernelID)
 	kernelidBytes, err := ioutil.ReadFile(localFilePath)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			log.Fatal("[FATAL] Read local kernel id file::", localFilePath, err)
+			log.Println("[ERROR-Kernel] Read local kernel id file::", localFilePath, err)
+			return err
 		}
 	}
 
@@ -73,7 +98,8 @@ func (kernel *Kernel) initialize(workerFactory worker.Factory) {
 		kernelidBytes = []byte(uuid.String())
 		err := ioutil.WriteFile(localFilePath, kernelidBytes, 777)
 		if err != nil {
-			log.Fatal("[FATAL] Write local kernel id file::", localFilePath, err)
+			log.Println("[ERROR-Kernel] Write local kernel id file::", localFilePath, err)
+			return err
 		}
 	}
 
@@ -84,15 +110,29 @@ func (kernel *Kernel) initialize(workerFactory worker.Factory) {
 		kernel.kv.Close()
 	}
 
-	kv, err := kv.New(kernel.config.EtcdUrls)
-
-	if err != nil {
-		log.Fatal("[FATAL] Cannot Connect to KV Store(ETCD) : ", err)
+	if kernel.config.InMemoryKV {
+		kernel.kv = kv.NewMemory()
+		log.Println("[WARN-Kernel] Use in-memory KV Store. Data will not be persisted.")
 	} else {
-		log.Println("[INFO-Kernel] Connect to KV Store : ", kernel.config.EtcdUrls)
-	}
+		etcdUrls := kernel.config.EtcdUrls
+		if kernel.config.EmbeddedEtcd {
+			if err := kernel.startEtcdServer(); err != nil {
+				return err
+			}
+			etcdUrls = kernel.etcdServer.ClientURLs()
+		}
 
-	kernel.kv = kv
+		kv, err := kv.NewWithConfig(kv.Config{Endpoints: etcdUrls, DialTimeout: 3 * time.Second,
+			RequestTimeout: time.Duration(kernel.config.KVRequestTimeout)})
+
+		if err != nil {
+			log.Println("[ERROR-Kernel] Cannot Connect to KV Store(ETCD) : ", err)
+			return err
+		}
+		log.Println("[INFO-Kernel] Connect to KV Store : ", etcdUrls)
+
+		kernel.kv = kv
+	}
 
 	if kernel.clusterManager != nil {
 		kernel.clusterManager.Dispose()
@@ -101,8 +141,37 @@ func (kernel *Kernel) initialize(workerFactory worker.Factory) {
 	kernel.clusterManager = cluster.NewManager(kernel.id, *kernel.config, kernel.kv)
 
 	kernel.jobManager = job.NewManager(kernel.config.Cluster, kernel.id, kernel.kv)
+	kernel.jobManager.SetHandoffTimeout(time.Duration(kernel.config.HandoffTimeoutSeconds) * time.Second)
 
 	kernel.workerManager = worker.NewManager(kernel.config.Cluster, kernel.id, kernel.kv, workerFactory)
+	return nil
+}
+
+func (kernel *Kernel) startEtcdServer() error {
+	if kernel.etcdServer != nil {
+		return nil
+	}
+
+	server, err := kv.StartEmbeddedEtcd(kv.EmbedConfig{
+		Name:                kernel.config.Name,
+		Dir:                 filepath.Join(kernel.config.DataDir, "etcd"),
+		ClientURLs:          kernel.config.EtcdClientURLs,
+		PeerURLs:            kernel.config.EtcdPeerURLs,
+		AdvertiseClientURLs: kernel.config.EtcdAdvertiseClientURLs,
+		AdvertisePeerURLs:   kernel.config.EtcdAdvertisePeerURLs,
+		InitialCluster:      kernel.config.EtcdInitialCluster,
+		ClusterState:        kernel.config.EtcdClusterState,
+		ClusterToken:        kernel.config.Cluster,
+	})
+
+	if err != nil {
+		log.Println("[ERROR-Kernel] Cannot start embedded ETCD : ", err)
+		return err
+	}
+
+	log.Println("[INFO-Kernel] Embedded ETCD started : ", server.ClientURLs())
+	kernel.etcdServer = server
+	return nil
 }
 
 // ID get ID
@@ -115,18 +184,29 @@ func (kernel *Kernel) GetKV() kv.KV {
 	return kernel.kv
 }
 
-// GetClusterManager kernel.clusterManager
+// GetClusterManager kernel.clusterManager, nil after Stop
 func (kernel *Kernel) GetClusterManager() *cluster.Manager {
+	kernel.stateMutex.RLock()
+	defer kernel.stateMutex.RUnlock()
 	return kernel.clusterManager
 }
 
-// GetJobManager kernel.jobManager
+// GetJobManager kernel.jobManager, nil after Stop
 func (kernel *Kernel) GetJobManager() *job.Manager {
+	kernel.stateMutex.RLock()
+	defer kernel.stateMutex.RUnlock()
 	return kernel.jobManager
 }
 
 // Start ..
 func (kernel *Kernel) Start() (err error) {
+	kernel.running = true
+	kernel.done = make(chan struct{})
+	if err := kernel.kv.Ping(); err != nil {
+		log.Println("[ERROR-Kernel] KV Store is unreachable.", err)
+		kernel.setState(StateDisconnected)
+	}
+
 	kernel.clusterManager.SetMemberChangeHandler(func(aliveMembers []string) {
 		fmt.Println("********** Member Changed **********")
 		fmt.Println("   ** aliveMembers::", aliveMembers)
@@ -150,49 +230,130 @@ func (kernel *Kernel) Start() (err error) {
 	kernel.clusterManager.Start()
 
 	kernel.jobManager.SetMembJobWatchHandler(func(jobids []string) {
-		jobs := make(map[string][]byte)
-		for _, id := range jobids {
-			j, _ := kernel.jobManager.GetJob(id)
-			jobs[id] = j.Data
+		kernel.setWorkerJobs(jobids)
+		err := kernel.jobManager.AckHandoffs(jobids)
+		if err != nil {
+			log.Println("[ERROR-Kernel] AckHandoffs ", err)
 		}
-
-		kernel.workerManager.SetJobs(jobs)
+	})
+	kernel.jobManager.SetHandoffAckHandler(func(jobID string, handoff job.Handoff) {
+		log.Println("[INFO-Kernel] Job released.", jobID, handoff.From, "->", handoff.To)
+		kernel.activateHandoffs()
 	})
 
-	kernel.jobManager.SetJobWatchHandler(func(job *job.Job) {
-		log.Println("[WARN-Kernel] Job changed.", job)
+	kernel.jobManager.SetJobWatchHandler(func(event job.Event) {
+		log.Println("[WARN-Kernel] Job changed.", event.Type, event.Job.ID)
+		if event.IsRemoved() {
+			kernel.workerManager.ForgetJob(event.Job.ID)
+		}
+		if !event.IsRemoved() && kernel.workerManager.HasJob(event.Job.ID) {
+			// restarts the worker if the job is updated
+			jobids, err := kernel.jobManager.GetMemberJobIDs(kernel.id)
+			if err != nil {
+				log.Println("[ERROR-Kernel] GetMemberJobIDs ", err)
+			} else {
+				kernel.setWorkerJobs(jobids)
+			}
+		}
+		if kernel.clusterManager.IsLeader() {
+			aliveMembers := kernel.GetClusterManager().GetCluster().GetAliveMemberIDs()
+			allJobs, err := kernel.jobManager.GetAllJobs()
+			if err != nil {
+				log.Println("[ERROR-Kernel] GetAllJobs ", err)
+			}
+			kernel.distributeMemberJobs(allJobs, aliveMembers)
+		}
+	})
+	kernel.jobManager.SetPlacementWatchHandler(func(jobID string) {
+		log.Println("[WARN-Kernel] Job placement changed.", jobID)
 		if kernel.clusterManager.IsLeader() {
 			aliveMembers := kernel.GetClusterManager().GetCluster().GetAliveMemberIDs()
 			allJobs, err := kernel.jobManager.GetAllJobs()
 			if err != nil {
 				log.Println("[ERROR-Kernel] GetAllJobs ", err)
+				return
 			}
 			kernel.distributeMemberJobs(allJobs, aliveMembers)
 		}
 	})
+	kernel.jobManager.SetJobResyncHandler(func(allJobs map[string]job.Job) {
+		log.Println("[WARN-Kernel] Jobs resynced.", len(allJobs))
+		if kernel.clusterManager.IsLeader() {
+			aliveMembers := kernel.GetClusterManager().GetCluster().GetAliveMemberIDs()
+			kernel.distributeMemberJobs(allJobs, aliveMembers)
+		}
+	})
 	kernel.jobManager.Start()
 
+	kernel.routines.Add(2)
+	go func() {
+		defer kernel.routines.Done()
+		kernel.checkConnection()
+	}()
+	go func() {
+		defer kernel.routines.Done()
+		kernel.checkHandoffs()
+	}()
+
 	log.Println("[INFO-Kernel] Kernel Starts. ", kernel.config)
 	return err
 }
 
-// Stop ..
+// Stop .. Goroutines and watch handlers of the kernel end before managers are released.
 func (kernel *Kernel) Stop() {
-	if kernel.kv != nil {
-		kernel.kv.Close()
-		kernel.kv = nil
+	kernel.running = false
+	if kernel.done != nil {
+		close(kernel.done)
+		kernel.routines.Wait()
+		kernel.done = nil
 	}
+
+	// handlers of each manager use the other, so both are disposed before they are released
 	if kernel.clusterManager != nil {
 		kernel.clusterManager.Dispose()
-		kernel.clusterManager = nil
 	}
-
 	if kernel.jobManager != nil {
 		kernel.jobManager.Dispose()
-		kernel.jobManager = nil
 	}
+	kernel.stateMutex.Lock()
+	kernel.clusterManager = nil
+	kernel.jobManager = nil
+	kernel.stateMutex.Unlock()
 
 	kernel.workerManager.Dispose()
+
+	if kernel.kv != nil {
+		kernel.kv.Close()
+		kernel.kv = nil
+	}
+
+	if kernel.etcdServer != nil {
+		kernel.etcdServer.Close()
+		kernel.etcdServer = nil
+	}
+}
+
+// ValidateJob checks job data with the worker factories. Invalid data is reported by *worker.ValidationError.
+func (kernel *Kernel) ValidateJob(data []byte) error {
+	return kernel.rootWorkerFactory.Validate(data)
+}
+
+// setWorkerJobs runs workers of jobids on local member with their current specs.
+// Workers keep their specs when jobs cannot be read.
+func (kernel *Kernel) setWorkerJobs(jobids []string) {
+	jobs := make(map[string]worker.JobSpec)
+	for _, id := range jobids {
+		j, err := kernel.jobManager.GetJob(id)
+		if err == nil {
+			jobs[id] = worker.JobSpec{Data: j.Data, Version: j.Version}
+			continue
+		}
+		log.Println("[ERROR-Kernel] Cannot read job ", id, err)
+		if spec, ok := kernel.workerManager.JobSpec(id); ok {
+			jobs[id] = spec
+		}
+	}
+	kernel.workerManager.SetJobs(jobs)
 }
 
 func (kernel *Kernel) distributeMemberJobs(allJobs map[string]job.Job, aliveMembers []string) {
@@ -215,7 +376,13 @@ func (kernel *Kernel) distributeMemberJobs(allJobs map[string]job.Job, aliveMemb
 
 	log.Println(buffer.String())
 
-	membJobMap, err = kernel.jobOrganizer.Distribute(allJobs, aliveMembers, membJobMap)
+	membJobMap, err = kernel.organize(allJobs, aliveMembers, membJobMap)
+	if placementErr, ok := err.(*job.PlacementError); ok {
+		log.Println("[WARN-Kernel] Distribute jobs ", placementErr)
+	} else if err != nil {
+		log.Println("[ERROR-Kernel] Distribute jobs ", err)
+		return
+	}
 
 	buffer.WriteString("[WARN-Kernel] After Organizing::\n")
 	for k, v := range membJobMap {
@@ -224,7 +391,111 @@ func (kernel *Kernel) distributeMemberJobs(allJobs map[string]job.Job, aliveMemb
 
 	log.Println(buffer.String())
 
-	for memb, jobs := range membJobMap {
-		kernel.jobManager.SetMemberJobIDs(memb, jobs)
+	leaderKey, term := kernel.clusterManager.LeaderKey()
+	err = kernel.jobManager.SetAllMemberJobIDs(leaderKey, term, membJobMap, aliveMembers)
+	if err != nil {
+		log.Println("[ERROR-Kernel] SetAllMemberJobIDs ", err)
+	}
+}
+
+// organize distributes weighed jobs to alive members which are not draining, with the job organizer
+func (kernel *Kernel) organize(allJobs map[string]job.Job, aliveMembers []string,
+	membJobMap map[string][]string) (map[string][]string, error) {
+	kernel.weighJobs(allJobs)
+	return job.Distribute(kernel.jobOrganizer, allJobs, kernel.activeMembers(aliveMembers), membJobMap)
+}
+
+// activeMembers returns metadata of alive members which are not draining.
+// Draining members are alive until they release their jobs, but get no jobs.
+func (kernel *Kernel) activeMembers(aliveMembers []string) []job.Member {
+	activeMembers := []job.Member{}
+	for _, membID := range aliveMembers {
+		memb := kernel.clusterManager.GetCluster().GetMember(membID)
+		if memb == nil {
+			activeMembers = append(activeMembers, job.Member{ID: membID})
+		} else if !memb.Draining {
+			activeMembers = append(activeMembers, job.Member{ID: membID, Zone: memb.Zone,
+				Labels: memb.Labels, Capacity: memb.Capacity, Cordoned: memb.IsCordoned()})
+		}
+	}
+	return activeMembers
+}
+
+// weighJobs sets weights of jobs with worker factories
+func (kernel *Kernel) weighJobs(allJobs map[string]job.Job) {
+	for id, j := range allJobs {
+		weight, err := kernel.rootWorkerFactory.Weight(j.Data)
+		if err != nil {
+			log.Println("[WARN-Kernel] Cannot weigh job ", id, err)
+		}
+		j.Weight = weight
+		allJobs[id] = j
+	}
+}
+
+// MemberLoads returns total weight of jobs assigned to each member
+func (kernel *Kernel) MemberLoads() (loads map[string]int, err error) {
+	allJobs, err := kernel.jobManager.GetAllJobs()
+	if err != nil {
+		return nil, err
+	}
+	membJobMap, err := kernel.jobManager.GetAllMemberJobIDs()
+	if err != nil {
+		return nil, err
+	}
+	kernel.weighJobs(allJobs)
+	return job.MemberLoads(allJobs, membJobMap), nil
+}
+
+// Drain moves jobs of local member to other members, and waits at most timeout until all local workers stop.
+// Drained kernel leaves the cluster on Stop.
+func (kernel *Kernel) Drain(timeout time.Duration) (err error) {
+	err = kernel.clusterManager.Drain()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for len(kernel.workerManager.GetWorkerIDs()) > 0 {
+		if time.Now().After(deadline) {
+			return ErrDrainTimeout
+		}
+		time.Sleep(drainCheckInterval)
+	}
+	log.Println("[INFO-Kernel] Kernel drained.")
+	return nil
+}
+
+// activateHandoffs assigns released or timed out jobs to their new members, if local member is the leader
+func (kernel *Kernel) activateHandoffs() {
+	clusterManager := kernel.GetClusterManager()
+	jobManager := kernel.GetJobManager()
+	if clusterManager == nil || jobManager == nil || !clusterManager.IsLeader() {
+		return
+	}
+	leaderKey, term := clusterManager.LeaderKey()
+	aliveMembers := clusterManager.GetCluster().GetAliveMemberIDs()
+	err := jobManager.ActivateHandoffs(leaderKey, term, aliveMembers)
+	if err != nil {
+		log.Println("[ERROR-Kernel] ActivateHandoffs ", err)
+	}
+}
+
+// checkHandoffs activates timed out handoffs periodically
+func (kernel *Kernel) checkHandoffs() {
+	for kernel.sleep(time.Duration(kernel.config.CheckHeartbeatInterval)) {
+		if state, _ := kernel.State(); state == StateConnected {
+			kernel.activateHandoffs()
+		}
+	}
+}
+
+// sleep waits for d, and returns false if the kernel is stopped meanwhile
+func (kernel *Kernel) sleep(d time.Duration) bool {
+	select {
+	case <-kernel.done:
+		return false
+	case <-time.After(d):
+		return true
 	}
 }
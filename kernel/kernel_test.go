@@ -0,0 +1,295 @@
+package kernel
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/job"
+	"github.com/rhizomata/bridge-chain-etcd/kernel/model"
+	"github.com/rhizomata/bridge-chain-etcd/kernel/worker"
+)
+
+type testWorker struct {
+	id      string
+	started bool
+}
+
+func (worker *testWorker) ID() string      { return worker.id }
+func (worker *testWorker) Start() error    { worker.started = true; return nil }
+func (worker *testWorker) Stop() error     { worker.started = false; return nil }
+func (worker *testWorker) IsStarted() bool { return worker.started }
+
+// testFactory creates workers which write their job data as checkpoint, and reports
+// job data with the previous checkpoint as "data|checkpoint"
+type testFactory struct {
+	created chan string
+}
+
+func (factory *testFactory) Name() string { return "test" }
+func (factory *testFactory) NewWorker(helper *worker.Helper) (worker.Worker, error) {
+	checkpoint := ""
+	helper.GetCheckpoint(&checkpoint)
+	helper.PutCheckpoint(string(helper.Job()))
+	factory.created <- string(helper.Job()) + "|" + checkpoint
+	return &testWorker{id: helper.ID()}, nil
+}
+
+// testConfig returns config of a single member kernel on in-memory KV, with a new data directory
+func testConfig(t *testing.T) *model.Config {
+	dir, err := ioutil.TempDir("", "kernel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.Config{Cluster: "c1", Name: "n1", Hostname: "127.0.0.1", Port: 1, DataDir: dir,
+		HeartbeatInterval: uint(200 * time.Millisecond), CheckHeartbeatInterval: uint(200 * time.Millisecond),
+		AliveThreasholdSeconds: 3, InMemoryKV: true}
+}
+
+// newTestKernel creates a kernel with config. stop must be called at the end of the test.
+func newTestKernel(t *testing.T, config *model.Config) (kernel *Kernel, factory *testFactory, stop func()) {
+	kernel, err := New(config)
+	if err != nil {
+		os.RemoveAll(config.DataDir)
+		t.Fatal(err)
+	}
+	factory = &testFactory{created: make(chan string, 10)}
+	kernel.RegisterWorkerFactory(factory)
+	kernel.SetJobOrganizer(job.NewSimpleOrganizer())
+	stop = func() {
+		kernel.Stop()
+		os.RemoveAll(config.DataDir)
+	}
+	return kernel, factory, stop
+}
+
+// startTestKernel starts a kernel of newTestKernel and waits until it is elected.
+func startTestKernel(t *testing.T, config *model.Config) (kernel *Kernel, factory *testFactory, stop func()) {
+	kernel, factory, stop = newTestKernel(t, config)
+	if err := kernel.Start(); err != nil {
+		stop()
+		t.Fatal(err)
+	}
+	waitFor(t, "leader is elected", func() bool { return kernel.GetClusterManager().IsElected() })
+	return kernel, factory, stop
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out:", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestKernelDisconnectPausesWorkers(t *testing.T) {
+	kernel, _, stop := newTestKernel(t, testConfig(t))
+	defer stop()
+
+	kernel.setState(StateDisconnected)
+	status := kernel.Status()
+	if status.State != "disconnected" || !status.Paused || !kernel.workerManager.IsPaused() {
+		t.Fatal("workers are not paused on disconnect", status)
+	}
+
+	kernel.setState(StateConnected)
+	status = kernel.Status()
+	if status.State != "connected" || status.Paused || kernel.workerManager.IsPaused() {
+		t.Fatal("workers are not resumed on reconnect", status)
+	}
+}
+
+func TestKernelStatusWhileStopping(t *testing.T) {
+	kernel, _, stop := startTestKernel(t, testConfig(t))
+
+	wait := sync.WaitGroup{}
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for i := 0; i < 100; i++ {
+			kernel.Status()
+		}
+	}()
+	stop()
+	wait.Wait()
+
+	if status := kernel.Status(); status.Leader {
+		t.Fatal("stopped kernel is leader", status)
+	}
+}
+
+func TestKernelDrain(t *testing.T) {
+	kernel, _, stop := startTestKernel(t, testConfig(t))
+	defer stop()
+
+	if err := kernel.GetJobManager().AddJob(job.NewJob([]byte("#test:v1"))); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "worker is started", func() bool { return len(kernel.workerManager.GetWorkerIDs()) == 1 })
+
+	// the only member keeps its jobs while draining, as no other member takes them
+	if err := kernel.Drain(500 * time.Millisecond); err != ErrDrainTimeout {
+		t.Fatal("drain of the only member must time out", err)
+	}
+	if status := kernel.Status(); !status.Draining || len(status.Workers) != 1 {
+		t.Fatal("draining kernel dropped its jobs", status)
+	}
+}
+
+// memberOrganizer records members it distributes jobs to
+type memberOrganizer struct {
+	job.Organizer
+	members chan []job.Member
+}
+
+func (organizer *memberOrganizer) DistributeToMembers(allJobs map[string]job.Job, members []job.Member,
+	membJobMap map[string][]string) (map[string][]string, error) {
+	organizer.members <- members
+	ids := []string{}
+	for _, memb := range members {
+		ids = append(ids, memb.ID)
+	}
+	return organizer.Distribute(allJobs, ids, membJobMap)
+}
+
+func TestKernelMemberMetadata(t *testing.T) {
+	config := testConfig(t)
+	config.Zone = "z1"
+	config.Labels = map[string]string{"region": "r1"}
+	config.Capacity = 5
+	kernel, _, stop := newTestKernel(t, config)
+	defer stop()
+	organizer := &memberOrganizer{Organizer: job.NewSimpleOrganizer(), members: make(chan []job.Member, 100)}
+	kernel.SetJobOrganizer(organizer)
+	if err := kernel.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case members := <-organizer.members:
+		if len(members) != 1 {
+			t.Fatal("organizer got members", members)
+		}
+		memb := members[0]
+		if memb.ID != kernel.ID() || memb.Zone != "z1" || memb.Labels["region"] != "r1" || memb.Capacity != 5 {
+			t.Fatal("member metadata does not reach organizer", memb)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("jobs are not distributed")
+	}
+}
+
+func waitCreated(t *testing.T, factory *testFactory) string {
+	select {
+	case created := <-factory.created:
+		return created
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker is not created")
+	}
+	return ""
+}
+
+func waitState(t *testing.T, kernel *Kernel, jobID string, state string) worker.JobStatus {
+	var status worker.JobStatus
+	waitFor(t, "job is "+state, func() bool {
+		status, _ = kernel.JobStatus(jobID)
+		return status.State == state
+	})
+	return status
+}
+
+func TestKernelAddJob(t *testing.T) {
+	kernel, factory, stop := startTestKernel(t, testConfig(t))
+	defer stop()
+
+	j := job.NewJob([]byte("#test:v1"))
+	if err := kernel.GetJobManager().AddJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if created := waitCreated(t, factory); created != "v1|" {
+		t.Fatal("worker is created with", created)
+	}
+	status := waitState(t, kernel, j.ID, worker.JobRunning)
+	if status.Owner != kernel.ID() {
+		t.Fatal("job is run by", status.Owner)
+	}
+}
+
+func TestKernelPauseResumeJob(t *testing.T) {
+	kernel, factory, stop := startTestKernel(t, testConfig(t))
+	defer stop()
+
+	j := job.NewJob([]byte("#test:v1"))
+	if err := kernel.GetJobManager().AddJob(j); err != nil {
+		t.Fatal(err)
+	}
+	waitCreated(t, factory)
+	waitState(t, kernel, j.ID, worker.JobRunning)
+
+	if err := kernel.GetJobManager().PauseJob(j.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, kernel, j.ID, worker.JobPaused)
+	waitFor(t, "worker is stopped", func() bool { return len(kernel.workerManager.GetWorkerIDs()) == 0 })
+
+	paused, err := kernel.GetJobManager().GetJob(j.ID)
+	if err != nil || !paused.Paused || string(paused.Data) != "#test:v1" {
+		t.Fatal("paused job is not kept", paused, err)
+	}
+
+	// the resumed worker gets the checkpoint of the paused worker
+	if err = kernel.GetJobManager().ResumeJob(j.ID); err != nil {
+		t.Fatal(err)
+	}
+	if created := waitCreated(t, factory); created != "v1|v1" {
+		t.Fatal("worker is resumed with", created)
+	}
+	waitFor(t, "restart is counted", func() bool {
+		status, _ := kernel.JobStatus(j.ID)
+		return status.State == worker.JobRunning && status.RestartCount == 1
+	})
+
+	if err = kernel.GetJobManager().PauseJob("none"); err == nil {
+		t.Fatal("missing job must not be paused")
+	}
+}
+
+func TestKernelUpdateJob(t *testing.T) {
+	kernel, factory, stop := startTestKernel(t, testConfig(t))
+	defer stop()
+
+	j := job.NewJob([]byte("#test:v1"))
+	if err := kernel.GetJobManager().AddJob(j); err != nil {
+		t.Fatal(err)
+	}
+	waitCreated(t, factory)
+	waitState(t, kernel, j.ID, worker.JobRunning)
+
+	updated, err := kernel.GetJobManager().UpdateJob(job.Job{ID: j.ID, Name: "n", Data: []byte("#test:v2")})
+	if err != nil || updated.Version != 2 {
+		t.Fatal("job is not updated", updated, err)
+	}
+	// the worker restarts with the new data and the checkpoint of the previous worker
+	if created := waitCreated(t, factory); created != "v2|v1" {
+		t.Fatal("worker is restarted with", created)
+	}
+	waitFor(t, "restart is counted", func() bool {
+		status, _ := kernel.JobStatus(j.ID)
+		return status.State == worker.JobRunning && status.RestartCount == 1
+	})
+
+	// changes other than data do not restart the worker
+	updated, err = kernel.GetJobManager().UpdateJob(job.Job{ID: j.ID, Name: "m", Data: []byte("#test:v2")})
+	if err != nil || updated.Version != 2 || updated.Name != "m" {
+		t.Fatal("job name is not updated", updated, err)
+	}
+	select {
+	case created := <-factory.created:
+		t.Fatal("worker is restarted without data change", created)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
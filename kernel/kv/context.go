@@ -0,0 +1,184 @@
+package kv
+
+import (
+	"context"
+	"time"
+)
+
+// defaultContext implements methods of KV without context by calling ContextKV
+// with the request timeout. KV implementations embed it.
+type defaultContext struct {
+	kv      ContextKV
+	timeout time.Duration
+}
+
+func (dc defaultContext) requestTimeout() time.Duration {
+	return dc.timeout
+}
+
+func (dc defaultContext) newContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), dc.timeout)
+}
+
+// PutObject ..
+func (dc defaultContext) PutObject(key string, value interface{}) (revision int64, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.PutObjectContext(ctx, key, value)
+}
+
+// Put ..
+func (dc defaultContext) Put(key, val string) (revision int64, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.PutContext(ctx, key, val)
+}
+
+// PutWithLease ..
+func (dc defaultContext) PutWithLease(key, val string, lease LeaseID) (revision int64, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.PutWithLeaseContext(ctx, key, val, lease)
+}
+
+// GetOne ..
+func (dc defaultContext) GetOne(key string) (value []byte, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.GetOneContext(ctx, key)
+}
+
+// GetOneWithRevision ..
+func (dc defaultContext) GetOneWithRevision(key string) (value []byte, modRevision int64, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.GetOneWithRevisionContext(ctx, key)
+}
+
+// GetOneWithStoreRevision ..
+func (dc defaultContext) GetOneWithStoreRevision(key string) (value []byte, revision int64, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.GetOneWithStoreRevisionContext(ctx, key)
+}
+
+// GetObject ..
+func (dc defaultContext) GetObject(key string, obj interface{}) (err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.GetObjectContext(ctx, key, obj)
+}
+
+// GetWithPrefix ..
+func (dc defaultContext) GetWithPrefix(key string, handler func(key string, value []byte)) (err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.GetWithPrefixContext(ctx, key, handler)
+}
+
+// GetWithPrefixLimit ..
+func (dc defaultContext) GetWithPrefixLimit(key string, limit int64, handler func(key string, value []byte)) (err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.GetWithPrefixLimitContext(ctx, key, limit, handler)
+}
+
+// GetWithPrefixRevision ..
+func (dc defaultContext) GetWithPrefixRevision(key string, handler func(key string, value []byte)) (revision int64, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.GetWithPrefixRevisionContext(ctx, key, handler)
+}
+
+// DeleteOne ..
+func (dc defaultContext) DeleteOne(key string) (deleted bool, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.DeleteOneContext(ctx, key)
+}
+
+// DeleteWithPrefix ..
+func (dc defaultContext) DeleteWithPrefix(key string) (deleted int64, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.DeleteWithPrefixContext(ctx, key)
+}
+
+// Watch ..
+func (dc defaultContext) Watch(key string, handler func(key string, value []byte)) *Watcher {
+	return dc.kv.WatchContext(context.Background(), key, handler)
+}
+
+// WatchWithPrefix ..
+func (dc defaultContext) WatchWithPrefix(key string, handler func(key string, value []byte)) *Watcher {
+	return dc.kv.WatchWithPrefixContext(context.Background(), key, handler)
+}
+
+// WatchEvents ..
+func (dc defaultContext) WatchEvents(key string, handler func(event Event)) *Watcher {
+	return dc.kv.WatchEventsContext(context.Background(), key, handler)
+}
+
+// WatchEventsWithPrefix ..
+func (dc defaultContext) WatchEventsWithPrefix(key string, handler func(event Event)) *Watcher {
+	return dc.kv.WatchEventsWithPrefixContext(context.Background(), key, handler)
+}
+
+// WatchEventsFrom ..
+func (dc defaultContext) WatchEventsFrom(key string, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	return dc.kv.WatchEventsFromContext(context.Background(), key, revision, handler, compacted)
+}
+
+// WatchEventsWithPrefixFrom ..
+func (dc defaultContext) WatchEventsWithPrefixFrom(key string, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	return dc.kv.WatchEventsWithPrefixFromContext(context.Background(), key, revision, handler, compacted)
+}
+
+// Compact ..
+func (dc defaultContext) Compact(revision int64) (err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.CompactContext(ctx, revision)
+}
+
+// Txn ..
+func (dc defaultContext) Txn(compares []Compare, ops []Op) (succeeded bool, revision int64, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.TxnContext(ctx, compares, ops)
+}
+
+// GrantLease ..
+func (dc defaultContext) GrantLease(ttl int64) (lease LeaseID, err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.GrantLeaseContext(ctx, ttl)
+}
+
+// KeepAlive ..
+func (dc defaultContext) KeepAlive(lease LeaseID) (err error) {
+	return dc.kv.KeepAliveContext(context.Background(), lease)
+}
+
+// KeepAliveOnce ..
+func (dc defaultContext) KeepAliveOnce(lease LeaseID) (err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.KeepAliveOnceContext(ctx, lease)
+}
+
+// RevokeLease ..
+func (dc defaultContext) RevokeLease(lease LeaseID) (err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.RevokeLeaseContext(ctx, lease)
+}
+
+// Ping ..
+func (dc defaultContext) Ping() (err error) {
+	ctx, cancel := dc.newContext()
+	defer cancel()
+	return dc.kv.PingContext(ctx)
+}
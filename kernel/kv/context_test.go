@@ -0,0 +1,97 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestContextCanceled(t *testing.T) {
+	store := NewMemory().(*MemoryKV)
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.PutContext(ctx, "k", "v"); !errors.Is(err, context.Canceled) {
+		t.Fatal("put with canceled context", err)
+	}
+	if _, err := store.GetOne("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("put with canceled context wrote", err)
+	}
+	if _, _, err := store.TxnContext(ctx, nil, []Op{OpPut("k", "v")}); !errors.Is(err, context.Canceled) {
+		t.Fatal("txn with canceled context", err)
+	}
+}
+
+func TestContextTimeout(t *testing.T) {
+	store := NewMemory().(*MemoryKV)
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if _, err := store.GetOneContext(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("get with expired context", err)
+	}
+}
+
+func TestContextWatchCanceled(t *testing.T) {
+	store := NewMemory().(*MemoryKV)
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher := store.WatchEventsContext(ctx, "k", func(event Event) {})
+	cancel()
+	select {
+	case <-watcher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("watcher is not ended by canceled context")
+	}
+}
+
+func TestContextKeepAliveCanceled(t *testing.T) {
+	store := NewMemory().(*MemoryKV)
+	defer store.Close()
+
+	lease, _ := store.GrantLease(1)
+	store.PutWithLease("k", "v", lease)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := store.KeepAliveContext(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, err := store.GetOne("k"); errors.Is(err, ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lease is kept alive after its context is canceled")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// deadlineKV records the deadline of the context passed by defaultContext
+type deadlineKV struct {
+	ContextKV
+	deadline time.Time
+}
+
+func (store *deadlineKV) GetOneContext(ctx context.Context, key string) (value []byte, err error) {
+	store.deadline, _ = ctx.Deadline()
+	return nil, nil
+}
+
+func TestDefaultContextTimeout(t *testing.T) {
+	store := &deadlineKV{}
+	dc := defaultContext{kv: store, timeout: time.Minute}
+
+	before := time.Now()
+	dc.GetOne("k")
+	if store.deadline.Before(before.Add(time.Minute)) || store.deadline.After(time.Now().Add(time.Minute)) {
+		t.Fatal("request timeout is not applied", store.deadline)
+	}
+}
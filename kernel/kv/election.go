@@ -0,0 +1,99 @@
+package kv
+
+import (
+	"context"
+	"errors"
+
+	"github.com/coreos/etcd/clientv3/concurrency"
+)
+
+// ErrNoLeader returned when no candidate is elected
+var ErrNoLeader = errors.New("Election has no leader")
+
+// Election : leader election among candidates, each holding a session lease.
+// Candidates are ordered by the create revision of their key. The first one is the leader,
+// and its create revision is the term, which increases with every new leader.
+type Election interface {
+	// Campaign blocks until elected or ctx is done
+	Campaign(ctx context.Context, value string) (term int64, err error)
+	// Resign gives up leadership, and lets the next candidate be elected
+	Resign(ctx context.Context) (err error)
+	// Leader returns value and term of current leader
+	Leader(ctx context.Context) (value string, term int64, err error)
+	// Key returns the key of this candidate, to fence writes with CreateRevisionEquals(key, term)
+	Key() string
+	// Done is closed when the session lease is lost. Leadership is lost with it.
+	Done() <-chan struct{}
+	// Close revokes the session lease
+	Close() error
+}
+
+// etcdElection implements Election with clientv3/concurrency
+type etcdElection struct {
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+// NewElection : Create an election candidate with its own session of ttl seconds
+func (etcd *EtcdKV) NewElection(name string, ttl int64) (election Election, err error) {
+	session, err := concurrency.NewSession(etcd.client, concurrency.WithTTL(int(ttl)))
+	if err != nil {
+		return nil, err
+	}
+	return &etcdElection{session: session, election: concurrency.NewElection(session, name)}, nil
+}
+
+// Campaign ..
+func (election *etcdElection) Campaign(ctx context.Context, value string) (term int64, err error) {
+	err = election.election.Campaign(ctx, value)
+	if err != nil {
+		return 0, err
+	}
+	return election.election.Rev(), nil
+}
+
+// Resign ..
+func (election *etcdElection) Resign(ctx context.Context) (err error) {
+	return election.election.Resign(ctx)
+}
+
+// Leader ..
+func (election *etcdElection) Leader(ctx context.Context) (value string, term int64, err error) {
+	r, err := election.election.Leader(ctx)
+	if err == concurrency.ErrElectionNoLeader {
+		return "", 0, ErrNoLeader
+	} else if err != nil {
+		return "", 0, err
+	}
+	return string(r.Kvs[0].Value), r.Kvs[0].CreateRevision, nil
+}
+
+// Key ..
+func (election *etcdElection) Key() string {
+	return election.election.Key()
+}
+
+// Done ..
+func (election *etcdElection) Done() <-chan struct{} {
+	return election.session.Done()
+}
+
+// Close ..
+func (election *etcdElection) Close() error {
+	return election.session.Close()
+}
+
+// namespaceElection strips the namespace prefix from Key
+type namespaceElection struct {
+	Election
+	namespace *namespaceKV
+}
+
+// Key ..
+func (election *namespaceElection) Key() string {
+	key := election.Election.Key()
+	if key == "" {
+		return ""
+	}
+	return election.namespace.strip(key)
+}
@@ -0,0 +1,160 @@
+package kv
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+)
+
+// EmbedConfig : embedded ETCD server configuration
+type EmbedConfig struct {
+	Name string
+	// Dir data directory of the server
+	Dir string
+	// ClientURLs urls to listen for clients
+	ClientURLs []string
+	// PeerURLs urls to listen for peers
+	PeerURLs []string
+	// AdvertiseClientURLs urls advertised to clients. ClientURLs if empty, unless they are wildcard addresses.
+	AdvertiseClientURLs []string
+	// AdvertisePeerURLs urls advertised to peers. PeerURLs if empty, unless they are wildcard addresses.
+	AdvertisePeerURLs []string
+	// InitialCluster name=peerURL,... of all members. Only this server if empty.
+	InitialCluster string
+	// ClusterState "new" to bootstrap a cluster, "existing" to join a running cluster
+	ClusterState string
+	// ClusterToken distinguishes clusters bootstrapped with the same InitialCluster
+	ClusterToken string
+	// StartTimeout time to wait until the server is ready
+	StartTimeout time.Duration
+}
+
+// EmbeddedEtcd ETCD server running in process
+type EmbeddedEtcd struct {
+	etcd       *embed.Etcd
+	clientURLs []string
+}
+
+// StartEmbeddedEtcd : Start ETCD server in process and wait until it is ready
+func StartEmbeddedEtcd(config EmbedConfig) (server *EmbeddedEtcd, err error) {
+	cfg := embed.NewConfig()
+	cfg.Name = config.Name
+	cfg.Dir = config.Dir
+
+	if len(config.ClientURLs) > 0 {
+		cfg.LCUrls, err = parseURLs(config.ClientURLs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(config.AdvertiseClientURLs) > 0 || len(config.ClientURLs) > 0 {
+		cfg.ACUrls, err = advertiseURLs(cfg.LCUrls, config.AdvertiseClientURLs, "client")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.PeerURLs) > 0 {
+		cfg.LPUrls, err = parseURLs(config.PeerURLs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(config.AdvertisePeerURLs) > 0 || len(config.PeerURLs) > 0 {
+		cfg.APUrls, err = advertiseURLs(cfg.LPUrls, config.AdvertisePeerURLs, "peer")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.InitialCluster != "" {
+		cfg.InitialCluster = config.InitialCluster
+	} else {
+		cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	}
+
+	if config.ClusterState != "" {
+		cfg.ClusterState = config.ClusterState
+	}
+
+	if config.ClusterToken != "" {
+		cfg.InitialClusterToken = config.ClusterToken
+	}
+
+	etcd, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	startTimeout := config.StartTimeout
+	if startTimeout <= 0 {
+		startTimeout = time.Minute
+	}
+
+	select {
+	case <-etcd.Server.ReadyNotify():
+	case err = <-etcd.Err():
+		etcd.Close()
+		return nil, err
+	case <-time.After(startTimeout):
+		etcd.Server.Stop()
+		etcd.Close()
+		return nil, errors.New("Embedded ETCD start timeout")
+	}
+
+	clientURLs := []string{}
+	for _, u := range cfg.ACUrls {
+		clientURLs = append(clientURLs, u.String())
+	}
+	log.Println("[INFO] Embedded ETCD is ready :", config.Name, clientURLs)
+
+	go func() {
+		err, ok := <-etcd.Err()
+		if ok && err != nil {
+			log.Println("[ERROR] Embedded ETCD :", err)
+		}
+	}()
+
+	return &EmbeddedEtcd{etcd: etcd, clientURLs: clientURLs}, nil
+}
+
+func parseURLs(rawURLs []string) (urls []url.URL, err error) {
+	urls = []url.URL{}
+	for _, rawURL := range rawURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, *u)
+	}
+	return urls, nil
+}
+
+// advertiseURLs parses advertised urls, or returns listen urls if none is given.
+// Wildcard listen addresses cannot be advertised, because peers and clients cannot reach them.
+func advertiseURLs(listenURLs []url.URL, advertised []string, kind string) (urls []url.URL, err error) {
+	if len(advertised) > 0 {
+		return parseURLs(advertised)
+	}
+	for _, u := range listenURLs {
+		ip := net.ParseIP(u.Hostname())
+		if u.Hostname() == "" || (ip != nil && ip.IsUnspecified()) {
+			return nil, errors.New("Advertise " + kind + " urls must be set to listen on wildcard address " + u.String())
+		}
+	}
+	return listenURLs, nil
+}
+
+// ClientURLs : advertised client urls, to connect with New
+func (server *EmbeddedEtcd) ClientURLs() []string {
+	return server.clientURLs
+}
+
+// Close : stop ETCD server
+func (server *EmbeddedEtcd) Close() {
+	server.etcd.Close()
+}
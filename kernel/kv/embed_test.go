@@ -0,0 +1,24 @@
+package kv
+
+import (
+	"testing"
+)
+
+func TestAdvertiseURLs(t *testing.T) {
+	listen, _ := parseURLs([]string{"http://10.0.0.1:2380"})
+	urls, err := advertiseURLs(listen, nil, "peer")
+	if err != nil || urls[0].String() != "http://10.0.0.1:2380" {
+		t.Fatal("listen urls are not advertised", urls, err)
+	}
+
+	for _, wildcard := range []string{"http://0.0.0.0:2380", "http://[::]:2380", "http://:2380"} {
+		listen, _ = parseURLs([]string{wildcard})
+		if _, err = advertiseURLs(listen, nil, "peer"); err == nil {
+			t.Fatal("wildcard address is advertised", wildcard)
+		}
+		urls, err = advertiseURLs(listen, []string{"http://10.0.0.1:2380"}, "peer")
+		if err != nil || urls[0].String() != "http://10.0.0.1:2380" {
+			t.Fatal("advertise urls are not used", urls, err)
+		}
+	}
+}
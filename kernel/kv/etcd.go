@@ -3,52 +3,51 @@ package kv
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"log"
+	"sync"
 	"time"
 
-	"go.etcd.io/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3"
 )
 
-// EtcdKV implements KV
-type EtcdKV struct {
-	etcdUrls []string
-	client   *clientv3.Client
-}
-
-// Watcher ..
-type Watcher struct {
-	Key          string
-	watchChannel clientv3.WatchChan
-	running      bool
-	handler      func(key string, value []byte)
+// Config : EtcdKV configuration
+type Config struct {
+	Endpoints   []string
+	DialTimeout time.Duration
+	// RequestTimeout timeout of KV methods without context
+	RequestTimeout time.Duration
 }
 
-func (watcher *Watcher) start() {
-	for watchResp := range watcher.watchChannel {
-		if !watcher.running {
-			break
-		}
-		kv := watchResp.Events[0].Kv
-		watcher.handler(watcher.Key, kv.Value)
-	}
+// EtcdKV implements KV
+type EtcdKV struct {
+	defaultContext
+	etcdUrls   []string
+	client     *clientv3.Client
+	mutex      sync.Mutex
+	keepAlives map[LeaseID]*keepAlive
 }
 
-// Stop stop watching
-func (watcher *Watcher) Stop() {
-	watcher.running = false
+// keepAlive cancels a running lease keepalive
+type keepAlive struct {
+	cancel context.CancelFunc
 }
 
 // New : Create EtcdKV instance
 func New(etcdUrls []string) (kv KV, err error) {
+	return NewWithConfig(Config{Endpoints: etcdUrls, DialTimeout: 3 * time.Second, RequestTimeout: DefaultRequestTimeout})
+}
+
+// NewWithConfig : Create EtcdKV instance
+func NewWithConfig(config Config) (kv KV, err error) {
+	etcdUrls := config.Endpoints
 	client, err := clientv3.New(clientv3.Config{
 		Endpoints:            etcdUrls,
-		DialTimeout:          3 * time.Second,
-		DialKeepAliveTimeout: 3 * time.Second,
+		DialTimeout:          config.DialTimeout,
+		DialKeepAliveTimeout: config.DialTimeout,
 	})
 
 	if err != nil {
-		log.Fatal("[BC-ERROR] Cannot connect to ETCD: ", etcdUrls, err)
+		log.Println("[BC-ERROR] Cannot create ETCD client: ", etcdUrls, err)
 		return nil, err
 	}
 
@@ -59,13 +58,21 @@ func New(etcdUrls []string) (kv KV, err error) {
 	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// client reconnects by itself, so an unreachable ETCD is not fatal here.
 	_, err = client.Status(timeoutCtx, etcdUrls[0])
 
 	if err != nil {
-		log.Fatal("[BC-ERROR] Cannot connect to ETCD: ", etcdUrls[0], " : ", err)
+		log.Println("[BC-WARN] Cannot connect to ETCD yet: ", etcdUrls[0], " : ", err)
+	}
+
+	requestTimeout := config.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = DefaultRequestTimeout
 	}
 
 	etcd := EtcdKV{etcdUrls: etcdUrls, client: client}
+	etcd.defaultContext = defaultContext{kv: &etcd, timeout: requestTimeout}
+	etcd.keepAlives = make(map[LeaseID]*keepAlive)
 	return &etcd, nil
 }
 
@@ -74,20 +81,32 @@ func (etcd *EtcdKV) Close() error {
 	return etcd.client.Close()
 }
 
-// Put ..
-func (etcd *EtcdKV) Put(key, val string) (revision int64, err error) {
-	r, err := etcd.put(context.Background(), key, val)
-	return r.Header.Revision, err
+// PutContext ..
+func (etcd *EtcdKV) PutContext(ctx context.Context, key, val string) (revision int64, err error) {
+	r, err := etcd.put(ctx, key, val)
+	if err != nil {
+		return 0, err
+	}
+	return r.Header.Revision, nil
 }
 
-// PutObject ..
-func (etcd *EtcdKV) PutObject(key string, value interface{}) (revision int64, err error) {
+// PutWithLeaseContext ..
+func (etcd *EtcdKV) PutWithLeaseContext(ctx context.Context, key, val string, lease LeaseID) (revision int64, err error) {
+	r, err := etcd.put(ctx, key, val, leaseOption(lease)...)
+	if err != nil {
+		return 0, toLeaseError(err)
+	}
+	return r.Header.Revision, nil
+}
+
+// PutObjectContext ..
+func (etcd *EtcdKV) PutObjectContext(ctx context.Context, key string, value interface{}) (revision int64, err error) {
 	bytes, err := json.Marshal(value)
 	if err != nil {
 		log.Println("[ERROR] Cannot Json marshal Object : ", err)
 	}
 
-	return etcd.Put(key, string(bytes))
+	return etcd.PutContext(ctx, key, string(bytes))
 }
 
 func (etcd *EtcdKV) put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
@@ -95,9 +114,9 @@ func (etcd *EtcdKV) put(ctx context.Context, key, val string, opts ...clientv3.O
 	return r, err
 }
 
-// GetOne ..
-func (etcd *EtcdKV) GetOne(key string) (value []byte, err error) {
-	r, err := etcd.get(context.Background(), key)
+// GetOneContext ..
+func (etcd *EtcdKV) GetOneContext(ctx context.Context, key string) (value []byte, err error) {
+	r, err := etcd.get(ctx, key)
 
 	if err != nil {
 		return nil, err
@@ -107,12 +126,42 @@ func (etcd *EtcdKV) GetOne(key string) (value []byte, err error) {
 		return r.Kvs[0].Value, nil
 	}
 
-	return nil, errors.New("No value for " + key)
+	return nil, notFound(key)
+}
+
+// GetOneWithRevisionContext ..
+func (etcd *EtcdKV) GetOneWithRevisionContext(ctx context.Context, key string) (value []byte, modRevision int64, err error) {
+	r, err := etcd.get(ctx, key)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if r.Count > 0 {
+		return r.Kvs[0].Value, r.Kvs[0].ModRevision, nil
+	}
+
+	return nil, 0, notFound(key)
 }
 
-// GetObject ..
-func (etcd *EtcdKV) GetObject(key string, obj interface{}) (err error) {
-	data, err := etcd.GetOne(key)
+// GetOneWithStoreRevisionContext ..
+func (etcd *EtcdKV) GetOneWithStoreRevisionContext(ctx context.Context, key string) (value []byte, revision int64, err error) {
+	r, err := etcd.get(ctx, key)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if r.Count > 0 {
+		return r.Kvs[0].Value, r.Header.Revision, nil
+	}
+
+	return nil, r.Header.Revision, notFound(key)
+}
+
+// GetObjectContext ..
+func (etcd *EtcdKV) GetObjectContext(ctx context.Context, key string, obj interface{}) (err error) {
+	data, err := etcd.GetOneContext(ctx, key)
 
 	if err != nil {
 		return err
@@ -122,9 +171,9 @@ func (etcd *EtcdKV) GetObject(key string, obj interface{}) (err error) {
 	return err
 }
 
-// GetWithPrefix ..
-func (etcd *EtcdKV) GetWithPrefix(key string, handler func(key string, value []byte)) (err error) {
-	r, err := etcd.get(context.Background(), key, clientv3.WithPrefix())
+// GetWithPrefixContext ..
+func (etcd *EtcdKV) GetWithPrefixContext(ctx context.Context, key string, handler func(key string, value []byte)) (err error) {
+	r, err := etcd.get(ctx, key, clientv3.WithPrefix())
 	if err != nil {
 		return err
 	}
@@ -136,9 +185,9 @@ func (etcd *EtcdKV) GetWithPrefix(key string, handler func(key string, value []b
 	return nil
 }
 
-// GetWithPrefixLimit ..
-func (etcd *EtcdKV) GetWithPrefixLimit(key string, limit int64, handler func(key string, value []byte)) (err error) {
-	r, err := etcd.get(context.Background(), key, clientv3.WithPrefix(), clientv3.WithLimit(limit))
+// GetWithPrefixLimitContext ..
+func (etcd *EtcdKV) GetWithPrefixLimitContext(ctx context.Context, key string, limit int64, handler func(key string, value []byte)) (err error) {
+	r, err := etcd.get(ctx, key, clientv3.WithPrefix(), clientv3.WithLimit(limit))
 	if err != nil {
 		return err
 	}
@@ -150,29 +199,43 @@ func (etcd *EtcdKV) GetWithPrefixLimit(key string, limit int64, handler func(key
 	return nil
 }
 
+// GetWithPrefixRevisionContext ..
+func (etcd *EtcdKV) GetWithPrefixRevisionContext(ctx context.Context, key string, handler func(key string, value []byte)) (revision int64, err error) {
+	r, err := etcd.get(ctx, key, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range r.Kvs {
+		handler(string(item.Key), item.Value)
+	}
+
+	return r.Header.Revision, nil
+}
+
 func (etcd *EtcdKV) get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
 	r, err := etcd.client.Get(ctx, key, opts...)
 	return r, err
 }
 
-// DeleteOne ..
-func (etcd *EtcdKV) DeleteOne(key string) (deleted bool, err error) {
-	r, err := etcd.delete(context.Background(), key)
+// DeleteOneContext ..
+func (etcd *EtcdKV) DeleteOneContext(ctx context.Context, key string) (deleted bool, err error) {
+	r, err := etcd.delete(ctx, key)
 	if err != nil {
 		return false, err
 	}
 
-	if r.Deleted != 1 {
+	if r.Deleted > 1 {
 		log.Println("[WARN] One more keys were deleted ", r.Deleted)
-		return true, err
+	} else if r.Deleted == 1 {
+		log.Println("[INFO] KV item deleted for ", key)
 	}
-	log.Println("[INFO] KV item deleted for ", key)
 	return r.Deleted > 0, nil
 }
 
-// DeleteWithPrefix ..
-func (etcd *EtcdKV) DeleteWithPrefix(key string) (deleted int64, err error) {
-	r, err := etcd.delete(context.Background(), key, clientv3.WithPrefix())
+// DeleteWithPrefixContext ..
+func (etcd *EtcdKV) DeleteWithPrefixContext(ctx context.Context, key string) (deleted int64, err error) {
+	r, err := etcd.delete(ctx, key, clientv3.WithPrefix())
 	if err != nil {
 		return 0, err
 	}
@@ -185,24 +248,138 @@ func (etcd *EtcdKV) delete(ctx context.Context, key string, opts ...clientv3.OpO
 	return r, err
 }
 
-// Watch ..
-func (etcd *EtcdKV) Watch(key string, handler func(key string, value []byte)) *Watcher {
-	watchChannel := etcd.client.Watch(context.Background(), key)
+// WatchContext ..
+func (etcd *EtcdKV) WatchContext(ctx context.Context, key string, handler func(key string, value []byte)) *Watcher {
+	return etcd.WatchEventsContext(ctx, key, valueHandler(handler))
+}
+
+// WatchWithPrefixContext ..
+func (etcd *EtcdKV) WatchWithPrefixContext(ctx context.Context, key string, handler func(key string, value []byte)) *Watcher {
+	return etcd.WatchEventsWithPrefixContext(ctx, key, valueHandler(handler))
+}
+
+// WatchEventsContext ..
+func (etcd *EtcdKV) WatchEventsContext(ctx context.Context, key string, handler func(event Event)) *Watcher {
+	return etcd.watch(ctx, key, handler, nil, clientv3.WithPrevKV())
+}
+
+// WatchEventsWithPrefixContext ..
+func (etcd *EtcdKV) WatchEventsWithPrefixContext(ctx context.Context, key string, handler func(event Event)) *Watcher {
+	return etcd.watch(ctx, key, handler, nil, clientv3.WithPrevKV(), clientv3.WithPrefix())
+}
+
+// WatchEventsFromContext ..
+func (etcd *EtcdKV) WatchEventsFromContext(ctx context.Context, key string, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	return etcd.watch(ctx, key, handler, compacted, clientv3.WithPrevKV(), clientv3.WithRev(revision))
+}
+
+// WatchEventsWithPrefixFromContext ..
+func (etcd *EtcdKV) WatchEventsWithPrefixFromContext(ctx context.Context, key string, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	return etcd.watch(ctx, key, handler, compacted, clientv3.WithPrevKV(), clientv3.WithPrefix(), clientv3.WithRev(revision))
+}
 
-	watcher := Watcher{Key: key, watchChannel: watchChannel, running: true, handler: handler}
+func (etcd *EtcdKV) watch(ctx context.Context, key string, handler func(event Event), compacted func(compactRevision int64),
+	opts ...clientv3.OpOption) *Watcher {
+	watchCtx, cancel := context.WithCancel(ctx)
+	watchChannel := etcd.client.Watch(watchCtx, key, opts...)
+
+	watcher := newWatcher(key, watchChannel, handler, compacted, cancel)
 	go func() {
 		watcher.start()
 	}()
-	return &watcher
+	return watcher
+}
+
+// CompactContext ..
+func (etcd *EtcdKV) CompactContext(ctx context.Context, revision int64) (err error) {
+	_, err = etcd.client.Compact(ctx, revision)
+	return err
+}
+
+// TxnContext ..
+func (etcd *EtcdKV) TxnContext(ctx context.Context, compares []Compare, ops []Op) (succeeded bool, revision int64, err error) {
+	cmps := []clientv3.Cmp{}
+	for _, compare := range compares {
+		cmps = append(cmps, compare.toCmp())
+	}
+
+	etcdOps := []clientv3.Op{}
+	for _, op := range ops {
+		etcdOps = append(etcdOps, op.toOp())
+	}
+
+	r, err := etcd.client.Txn(ctx).If(cmps...).Then(etcdOps...).Commit()
+	if err != nil {
+		return false, 0, toLeaseError(err)
+	}
+
+	return r.Succeeded, r.Header.Revision, nil
+}
+
+// GrantLeaseContext ..
+func (etcd *EtcdKV) GrantLeaseContext(ctx context.Context, ttl int64) (lease LeaseID, err error) {
+	r, err := etcd.client.Grant(ctx, ttl)
+	if err != nil {
+		return NoLease, err
+	}
+	return LeaseID(r.ID), nil
 }
 
-// WatchWithPrefix ..
-func (etcd *EtcdKV) WatchWithPrefix(key string, handler func(key string, value []byte)) *Watcher {
-	watchChannel := etcd.client.Watch(context.Background(), key, clientv3.WithPrefix())
+// KeepAliveContext ..
+func (etcd *EtcdKV) KeepAliveContext(ctx context.Context, lease LeaseID) (err error) {
+	keepAliveCtx, cancel := context.WithCancel(ctx)
+	ch, err := etcd.client.KeepAlive(keepAliveCtx, clientv3.LeaseID(lease))
+	if err != nil {
+		cancel()
+		return toLeaseError(err)
+	}
+
+	current := &keepAlive{cancel: cancel}
+	etcd.mutex.Lock()
+	if old, ok := etcd.keepAlives[lease]; ok {
+		old.cancel()
+	}
+	etcd.keepAlives[lease] = current
+	etcd.mutex.Unlock()
 
-	watcher := Watcher{Key: key, watchChannel: watchChannel, running: true, handler: handler}
 	go func() {
-		watcher.start()
+		for range ch {
+		}
+		log.Println("[WARN] Lease keepalive ends ", lease)
+		// remove the entry unless a newer keepalive replaced it
+		etcd.mutex.Lock()
+		if etcd.keepAlives[lease] == current {
+			delete(etcd.keepAlives, lease)
+		}
+		etcd.mutex.Unlock()
+		cancel()
 	}()
-	return &watcher
+	return nil
+}
+
+// KeepAliveOnceContext ..
+func (etcd *EtcdKV) KeepAliveOnceContext(ctx context.Context, lease LeaseID) (err error) {
+	_, err = etcd.client.KeepAliveOnce(ctx, clientv3.LeaseID(lease))
+	return toLeaseError(err)
+}
+
+// RevokeLeaseContext ..
+func (etcd *EtcdKV) RevokeLeaseContext(ctx context.Context, lease LeaseID) (err error) {
+	etcd.mutex.Lock()
+	if current, ok := etcd.keepAlives[lease]; ok {
+		current.cancel()
+		delete(etcd.keepAlives, lease)
+	}
+	etcd.mutex.Unlock()
+
+	_, err = etcd.client.Revoke(ctx, clientv3.LeaseID(lease))
+	return toLeaseError(err)
+}
+
+// PingContext : linearizable read, which fails without quorum
+func (etcd *EtcdKV) PingContext(ctx context.Context) (err error) {
+	_, err = etcd.client.Get(ctx, "ping", clientv3.WithCountOnly())
+	return err
 }
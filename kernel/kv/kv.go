@@ -1,16 +1,96 @@
 package kv
 
-// KV ..
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultRequestTimeout timeout of KV methods without context
+const DefaultRequestTimeout = 5 * time.Second
+
+// ErrNotFound returned when a key has no value. Errors wrapping it name the key, check them with errors.Is.
+var ErrNotFound = errors.New("Key not found")
+
+func notFound(key string) error {
+	return fmt.Errorf("No value for %s: %w", key, ErrNotFound)
+}
+
+// ContextKV : KV operations taking context. An operation fails when ctx is done before it completes.
+type ContextKV interface {
+	PutObjectContext(ctx context.Context, key string, value interface{}) (revision int64, err error)
+	PutContext(ctx context.Context, key, val string) (revision int64, err error)
+	PutWithLeaseContext(ctx context.Context, key, val string, lease LeaseID) (revision int64, err error)
+	GetOneContext(ctx context.Context, key string) (value []byte, err error)
+	GetOneWithRevisionContext(ctx context.Context, key string) (value []byte, modRevision int64, err error)
+	GetOneWithStoreRevisionContext(ctx context.Context, key string) (value []byte, revision int64, err error)
+	GetObjectContext(ctx context.Context, key string, obj interface{}) (err error)
+	GetWithPrefixContext(ctx context.Context, key string, handler func(key string, value []byte)) (err error)
+	GetWithPrefixLimitContext(ctx context.Context, key string, limit int64, handler func(key string, value []byte)) (err error)
+	GetWithPrefixRevisionContext(ctx context.Context, key string, handler func(key string, value []byte)) (revision int64, err error)
+	DeleteOneContext(ctx context.Context, key string) (deleted bool, err error)
+	DeleteWithPrefixContext(ctx context.Context, key string) (deleted int64, err error)
+	// Watches stop when ctx is done or Watcher.Stop is called
+	WatchContext(ctx context.Context, key string, handler func(key string, value []byte)) *Watcher
+	WatchWithPrefixContext(ctx context.Context, key string, handler func(key string, value []byte)) *Watcher
+	WatchEventsContext(ctx context.Context, key string, handler func(event Event)) *Watcher
+	WatchEventsWithPrefixContext(ctx context.Context, key string, handler func(event Event)) *Watcher
+	WatchEventsFromContext(ctx context.Context, key string, revision int64, handler func(event Event), compacted func(compactRevision int64)) *Watcher
+	WatchEventsWithPrefixFromContext(ctx context.Context, key string, revision int64, handler func(event Event), compacted func(compactRevision int64)) *Watcher
+	CompactContext(ctx context.Context, revision int64) (err error)
+	TxnContext(ctx context.Context, compares []Compare, ops []Op) (succeeded bool, revision int64, err error)
+	GrantLeaseContext(ctx context.Context, ttl int64) (lease LeaseID, err error)
+	// KeepAliveContext keeps the lease alive until ctx is done or the lease is revoked
+	KeepAliveContext(ctx context.Context, lease LeaseID) (err error)
+	KeepAliveOnceContext(ctx context.Context, lease LeaseID) (err error)
+	RevokeLeaseContext(ctx context.Context, lease LeaseID) (err error)
+	PingContext(ctx context.Context) (err error)
+}
+
+// KV .. Methods without context time out after the request timeout of the KV.
+// Watches and KeepAlive run until they are stopped.
 type KV interface {
+	ContextKV
 	Close() error
 	PutObject(key string, value interface{}) (revision int64, err error)
 	Put(key, val string) (revision int64, err error)
+	PutWithLease(key, val string, lease LeaseID) (revision int64, err error)
 	GetOne(key string) (value []byte, err error)
+	// GetOne, GetOneWithRevision fail with ErrNotFound for a missing key
+	GetOneWithRevision(key string) (value []byte, modRevision int64, err error)
+	// GetOneWithStoreRevision returns store revision of the read, to resume watching from revision+1.
+	// The revision is returned with ErrNotFound for a missing key too.
+	GetOneWithStoreRevision(key string) (value []byte, revision int64, err error)
 	GetObject(key string, obj interface{}) (err error)
 	GetWithPrefix(key string, handler func(key string, value []byte)) (err error)
 	GetWithPrefixLimit(key string, limit int64, handler func(key string, value []byte)) (err error)
+	// GetWithPrefixRevision returns store revision of the read, to resume watching from revision+1
+	GetWithPrefixRevision(key string, handler func(key string, value []byte)) (revision int64, err error)
 	DeleteOne(key string) (deleted bool, err error)
 	DeleteWithPrefix(key string) (deleted int64, err error)
 	Watch(key string, handler func(key string, value []byte)) *Watcher
 	WatchWithPrefix(key string, handler func(key string, value []byte)) *Watcher
+	// WatchEvents delivers every change of key with its type, value and previous value
+	WatchEvents(key string, handler func(event Event)) *Watcher
+	WatchEventsWithPrefix(key string, handler func(event Event)) *Watcher
+	// WatchEventsFrom delivers changes since revision. If revision is already compacted,
+	// compacted is called and the watcher stops.
+	WatchEventsFrom(key string, revision int64, handler func(event Event), compacted func(compactRevision int64)) *Watcher
+	WatchEventsWithPrefixFrom(key string, revision int64, handler func(event Event), compacted func(compactRevision int64)) *Watcher
+	// Compact discards history before revision
+	Compact(revision int64) (err error)
+	// Txn runs ops atomically when all compares are true
+	Txn(compares []Compare, ops []Op) (succeeded bool, revision int64, err error)
+	// GrantLease grants a lease which expires after ttl seconds without keepalive
+	GrantLease(ttl int64) (lease LeaseID, err error)
+	// KeepAlive keeps the lease alive in background until it is revoked or KV is closed
+	KeepAlive(lease LeaseID) (err error)
+	KeepAliveOnce(lease LeaseID) (err error)
+	// RevokeLease revokes the lease and deletes all keys attached to it
+	RevokeLease(lease LeaseID) (err error)
+	// Ping returns error when the store is not reachable
+	Ping() (err error)
+	// NewElection creates a candidate of election name, with a session lease of ttl seconds
+	NewElection(name string, ttl int64) (election Election, err error)
 }
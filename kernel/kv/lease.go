@@ -0,0 +1,36 @@
+package kv
+
+import (
+	"errors"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+// LeaseID : id of lease granted by KV store. Keys put with a lease are deleted when the lease expires.
+type LeaseID int64
+
+// NoLease : put without lease
+const NoLease LeaseID = 0
+
+// ErrLeaseNotFound returned when lease is expired or revoked
+var ErrLeaseNotFound = errors.New("Lease not found")
+
+// OpPutWithLease ..
+func OpPutWithLease(key, val string, lease LeaseID) Op {
+	return Op{Key: key, typ: opPut, value: val, lease: lease}
+}
+
+func toLeaseError(err error) error {
+	if err == rpctypes.ErrLeaseNotFound {
+		return ErrLeaseNotFound
+	}
+	return err
+}
+
+func leaseOption(lease LeaseID) []clientv3.OpOption {
+	if lease == NoLease {
+		return nil
+	}
+	return []clientv3.OpOption{clientv3.WithLease(clientv3.LeaseID(lease))}
+}
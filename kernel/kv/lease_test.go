@@ -0,0 +1,86 @@
+package kv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseKeepAlive(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	lease, err := store.GrantLease(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.KeepAlive(lease); err != nil {
+		t.Fatal(err)
+	}
+	store.PutWithLease("alive", "v", lease)
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err = store.GetOne("alive"); err != nil {
+		t.Fatal("key of kept alive lease is deleted", err)
+	}
+}
+
+func TestLeaseRevoke(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	lease, _ := store.GrantLease(10)
+	store.PutWithLease("a", "1", lease)
+	store.PutWithLease("b", "2", lease)
+	store.Put("c", "3")
+
+	events := make(chan Event, 10)
+	watcher := store.WatchEventsWithPrefix("", func(event Event) { events <- event })
+	defer watcher.Stop()
+
+	if err := store.RevokeLease(lease); err != nil {
+		t.Fatal(err)
+	}
+	revisions := make(map[int64]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-events:
+			if event.Type != EventDelete {
+				t.Fatal("unexpected event", event)
+			}
+			revisions[event.ModRevision] = true
+		case <-time.After(time.Second):
+			t.Fatal("delete of leased key is not watched")
+		}
+	}
+	if len(revisions) != 1 {
+		t.Fatal("keys of a lease must be deleted in one revision", revisions)
+	}
+	if _, err := store.GetOne("c"); err != nil {
+		t.Fatal("key without lease is deleted", err)
+	}
+
+	if err := store.RevokeLease(lease); err != ErrLeaseNotFound {
+		t.Fatal("revoked lease must not be found", err)
+	}
+	if _, err := store.PutWithLease("d", "4", lease); err != ErrLeaseNotFound {
+		t.Fatal("put with revoked lease must fail", err)
+	}
+	if _, _, err := store.Txn(nil, []Op{OpPutWithLease("d", "4", lease)}); err != ErrLeaseNotFound {
+		t.Fatal("txn with revoked lease must fail", err)
+	}
+}
+
+func TestLeaseDetachedByPut(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	lease, _ := store.GrantLease(10)
+	store.PutWithLease("k", "1", lease)
+	// put without lease detaches the key from the lease
+	store.Put("k", "2")
+	store.RevokeLease(lease)
+
+	if value, err := store.GetOne("k"); err != nil || string(value) != "2" {
+		t.Fatal("detached key is deleted with lease", err)
+	}
+}
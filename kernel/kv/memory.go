@@ -0,0 +1,724 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// ErrClosed returned when KV is already closed
+var ErrClosed = errors.New("KV is closed")
+
+// MemoryKV implements KV with in-process store. Use it for tests and single-node runs without etcd.
+type MemoryKV struct {
+	defaultContext
+	mutex      sync.Mutex
+	revision   int64
+	items      map[string]*mvccpb.KeyValue
+	watches    map[*memoryWatch]bool
+	leases     map[LeaseID]*memoryLease
+	lastLease  LeaseID
+	stopReaper chan struct{}
+	history    []*mvccpb.Event
+	compacted  int64
+	closed     bool
+}
+
+type memoryLease struct {
+	ttl       int64
+	expiresAt time.Time
+	keepAlive bool
+	keys      map[string]bool
+	// done is closed when the lease is revoked or expired
+	done chan struct{}
+}
+
+const (
+	memoryLeaseCheckInterval = 100 * time.Millisecond
+	// memoryHistoryLimit : older events are compacted automatically
+	memoryHistoryLimit = 10000
+)
+
+// NewMemory : Create MemoryKV instance
+func NewMemory() KV {
+	memory := MemoryKV{revision: 1}
+	memory.items = make(map[string]*mvccpb.KeyValue)
+	memory.watches = make(map[*memoryWatch]bool)
+	memory.leases = make(map[LeaseID]*memoryLease)
+	memory.defaultContext = defaultContext{kv: &memory, timeout: DefaultRequestTimeout}
+	return &memory
+}
+
+// check must be called with lock held.
+func (memory *MemoryKV) check(ctx context.Context) error {
+	if memory.closed {
+		return ErrClosed
+	}
+	return ctx.Err()
+}
+
+// Close : close all watchers
+func (memory *MemoryKV) Close() error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if memory.closed {
+		return nil
+	}
+	memory.closed = true
+
+	if memory.stopReaper != nil {
+		close(memory.stopReaper)
+	}
+
+	for watch := range memory.watches {
+		watch.close()
+	}
+	memory.watches = make(map[*memoryWatch]bool)
+	return nil
+}
+
+// PutContext ..
+func (memory *MemoryKV) PutContext(ctx context.Context, key, val string) (revision int64, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return 0, err
+	}
+
+	memory.revision++
+	memory.put(key, val, NoLease)
+	return memory.revision, nil
+}
+
+// PutWithLeaseContext ..
+func (memory *MemoryKV) PutWithLeaseContext(ctx context.Context, key, val string, lease LeaseID) (revision int64, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return 0, err
+	}
+
+	if lease != NoLease && memory.leases[lease] == nil {
+		return 0, ErrLeaseNotFound
+	}
+
+	memory.revision++
+	memory.put(key, val, lease)
+	return memory.revision, nil
+}
+
+// PutObjectContext ..
+func (memory *MemoryKV) PutObjectContext(ctx context.Context, key string, value interface{}) (revision int64, err error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		log.Println("[ERROR] Cannot Json marshal Object : ", err)
+	}
+
+	return memory.PutContext(ctx, key, string(bytes))
+}
+
+// put must be called with lock held and the revision already increased.
+func (memory *MemoryKV) put(key, val string, lease LeaseID) {
+	prev := memory.items[key]
+	item := &mvccpb.KeyValue{Key: []byte(key), Value: []byte(val), ModRevision: memory.revision, Lease: int64(lease)}
+
+	if prev != nil {
+		memory.detachLease(prev)
+	}
+	if lease != NoLease {
+		memory.leases[lease].keys[key] = true
+	}
+
+	if prev != nil {
+		item.CreateRevision = prev.CreateRevision
+		item.Version = prev.Version + 1
+	} else {
+		item.CreateRevision = memory.revision
+		item.Version = 1
+	}
+
+	memory.items[key] = item
+	memory.notify(&mvccpb.Event{Type: mvccpb.PUT, Kv: item, PrevKv: prev})
+}
+
+// GetOneContext ..
+func (memory *MemoryKV) GetOneContext(ctx context.Context, key string) (value []byte, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return nil, err
+	}
+
+	if item, ok := memory.items[key]; ok {
+		return copyBytes(item.Value), nil
+	}
+
+	return nil, notFound(key)
+}
+
+// GetOneWithRevisionContext ..
+func (memory *MemoryKV) GetOneWithRevisionContext(ctx context.Context, key string) (value []byte, modRevision int64, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	if item, ok := memory.items[key]; ok {
+		return copyBytes(item.Value), item.ModRevision, nil
+	}
+
+	return nil, 0, notFound(key)
+}
+
+// GetOneWithStoreRevisionContext ..
+func (memory *MemoryKV) GetOneWithStoreRevisionContext(ctx context.Context, key string) (value []byte, revision int64, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	if item, ok := memory.items[key]; ok {
+		return copyBytes(item.Value), memory.revision, nil
+	}
+
+	return nil, memory.revision, notFound(key)
+}
+
+// GetObjectContext ..
+func (memory *MemoryKV) GetObjectContext(ctx context.Context, key string, obj interface{}) (err error) {
+	data, err := memory.GetOneContext(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, obj)
+	return err
+}
+
+// GetWithPrefixContext ..
+func (memory *MemoryKV) GetWithPrefixContext(ctx context.Context, key string, handler func(key string, value []byte)) (err error) {
+	return memory.GetWithPrefixLimitContext(ctx, key, 0, handler)
+}
+
+// GetWithPrefixLimitContext ..
+func (memory *MemoryKV) GetWithPrefixLimitContext(ctx context.Context, key string, limit int64, handler func(key string, value []byte)) (err error) {
+	memory.mutex.Lock()
+	if err := memory.check(ctx); err != nil {
+		memory.mutex.Unlock()
+		return err
+	}
+	items := memory.rangePrefix(key, limit)
+	memory.mutex.Unlock()
+
+	for _, item := range items {
+		handler(string(item.Key), copyBytes(item.Value))
+	}
+
+	return nil
+}
+
+// GetWithPrefixRevisionContext ..
+func (memory *MemoryKV) GetWithPrefixRevisionContext(ctx context.Context, key string, handler func(key string, value []byte)) (revision int64, err error) {
+	memory.mutex.Lock()
+	if err := memory.check(ctx); err != nil {
+		memory.mutex.Unlock()
+		return 0, err
+	}
+	items := memory.rangePrefix(key, 0)
+	revision = memory.revision
+	memory.mutex.Unlock()
+
+	for _, item := range items {
+		handler(string(item.Key), copyBytes(item.Value))
+	}
+
+	return revision, nil
+}
+
+// rangePrefix returns items sorted by key like etcd does. must be called with lock held.
+func (memory *MemoryKV) rangePrefix(key string, limit int64) []*mvccpb.KeyValue {
+	keys := []string{}
+	for k := range memory.items {
+		if strings.HasPrefix(k, key) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	if limit > 0 && int64(len(keys)) > limit {
+		keys = keys[:limit]
+	}
+
+	items := []*mvccpb.KeyValue{}
+	for _, k := range keys {
+		items = append(items, memory.items[k])
+	}
+	return items
+}
+
+// DeleteOneContext ..
+func (memory *MemoryKV) DeleteOneContext(ctx context.Context, key string) (deleted bool, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return false, err
+	}
+
+	if _, ok := memory.items[key]; !ok {
+		return false, nil
+	}
+
+	memory.revision++
+	memory.delete(key)
+	log.Println("[INFO] KV item deleted for ", key)
+	return true, nil
+}
+
+// DeleteWithPrefixContext ..
+func (memory *MemoryKV) DeleteWithPrefixContext(ctx context.Context, key string) (deleted int64, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return 0, err
+	}
+
+	items := memory.rangePrefix(key, 0)
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	memory.revision++
+	for _, item := range items {
+		memory.delete(string(item.Key))
+	}
+
+	return int64(len(items)), nil
+}
+
+// delete must be called with lock held and the revision already increased.
+func (memory *MemoryKV) delete(key string) {
+	prev := memory.items[key]
+	delete(memory.items, key)
+	memory.detachLease(prev)
+
+	item := &mvccpb.KeyValue{Key: []byte(key), ModRevision: memory.revision}
+	memory.notify(&mvccpb.Event{Type: mvccpb.DELETE, Kv: item, PrevKv: prev})
+}
+
+// TxnContext ..
+func (memory *MemoryKV) TxnContext(ctx context.Context, compares []Compare, ops []Op) (succeeded bool, revision int64, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return false, 0, err
+	}
+
+	for _, op := range ops {
+		if op.lease != NoLease && memory.leases[op.lease] == nil {
+			return false, 0, ErrLeaseNotFound
+		}
+	}
+
+	for _, compare := range compares {
+		if !compare.evaluate(memory.items[compare.Key]) {
+			return false, memory.revision, nil
+		}
+	}
+
+	// all ops of a transaction share one revision
+	memory.revision++
+	changed := false
+
+	for _, op := range ops {
+		switch op.typ {
+		case opPut:
+			memory.put(op.Key, op.value, op.lease)
+			changed = true
+		case opDelete:
+			if _, ok := memory.items[op.Key]; ok {
+				memory.delete(op.Key)
+				changed = true
+			}
+		case opDeleteWithPrefix:
+			for _, item := range memory.rangePrefix(op.Key, 0) {
+				memory.delete(string(item.Key))
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		memory.revision--
+	}
+
+	return true, memory.revision, nil
+}
+
+// GrantLeaseContext ..
+func (memory *MemoryKV) GrantLeaseContext(ctx context.Context, ttl int64) (lease LeaseID, err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return NoLease, err
+	}
+
+	if memory.stopReaper == nil {
+		memory.stopReaper = make(chan struct{})
+		go memory.runReaper(memory.stopReaper)
+	}
+
+	memory.lastLease++
+	lease = memory.lastLease
+	memory.leases[lease] = &memoryLease{ttl: ttl, expiresAt: time.Now().Add(time.Duration(ttl) * time.Second),
+		keys: make(map[string]bool), done: make(chan struct{})}
+	return lease, nil
+}
+
+// KeepAliveContext ..
+func (memory *MemoryKV) KeepAliveContext(ctx context.Context, lease LeaseID) (err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return err
+	}
+
+	memoryLease := memory.leases[lease]
+	if memoryLease == nil {
+		return ErrLeaseNotFound
+	}
+	// The store lives in this process, so the lease is kept alive until it is revoked or ctx is done.
+	memoryLease.keepAlive = true
+
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			memory.mutex.Lock()
+			if memoryLease := memory.leases[lease]; memoryLease != nil {
+				memoryLease.keepAlive = false
+				memoryLease.expiresAt = time.Now().Add(time.Duration(memoryLease.ttl) * time.Second)
+			}
+			memory.mutex.Unlock()
+		}()
+	}
+	return nil
+}
+
+// KeepAliveOnceContext ..
+func (memory *MemoryKV) KeepAliveOnceContext(ctx context.Context, lease LeaseID) (err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return err
+	}
+
+	memoryLease := memory.leases[lease]
+	if memoryLease == nil {
+		return ErrLeaseNotFound
+	}
+	memoryLease.expiresAt = time.Now().Add(time.Duration(memoryLease.ttl) * time.Second)
+	return nil
+}
+
+// RevokeLeaseContext ..
+func (memory *MemoryKV) RevokeLeaseContext(ctx context.Context, lease LeaseID) (err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return err
+	}
+
+	if memory.leases[lease] == nil {
+		return ErrLeaseNotFound
+	}
+	memory.revokeLease(lease)
+	return nil
+}
+
+// revokeLease must be called with lock held. All attached keys are deleted in one revision.
+func (memory *MemoryKV) revokeLease(lease LeaseID) {
+	memoryLease := memory.leases[lease]
+	delete(memory.leases, lease)
+	close(memoryLease.done)
+
+	if len(memoryLease.keys) == 0 {
+		return
+	}
+
+	keys := []string{}
+	for key := range memoryLease.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	memory.revision++
+	for _, key := range keys {
+		memory.delete(key)
+	}
+}
+
+// detachLease must be called with lock held.
+func (memory *MemoryKV) detachLease(item *mvccpb.KeyValue) {
+	if item == nil || item.Lease == 0 {
+		return
+	}
+	if memoryLease := memory.leases[LeaseID(item.Lease)]; memoryLease != nil {
+		delete(memoryLease.keys, string(item.Key))
+	}
+}
+
+func (memory *MemoryKV) runReaper(stop chan struct{}) {
+	ticker := time.NewTicker(memoryLeaseCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			memory.mutex.Lock()
+			for lease, memoryLease := range memory.leases {
+				if !memoryLease.keepAlive && now.After(memoryLease.expiresAt) {
+					memory.revokeLease(lease)
+				}
+			}
+			memory.mutex.Unlock()
+		}
+	}
+}
+
+// CompactContext ..
+func (memory *MemoryKV) CompactContext(ctx context.Context, revision int64) (err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return err
+	}
+	if revision > memory.revision {
+		return errors.New("Cannot compact future revision")
+	}
+	memory.compact(revision)
+	return nil
+}
+
+// PingContext ..
+func (memory *MemoryKV) PingContext(ctx context.Context) (err error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	return memory.check(ctx)
+}
+
+// compact must be called with lock held.
+func (memory *MemoryKV) compact(revision int64) {
+	if revision <= memory.compacted {
+		return
+	}
+	index := 0
+	for index < len(memory.history) && memory.history[index].Kv.ModRevision < revision {
+		index++
+	}
+	memory.history = append([]*mvccpb.Event{}, memory.history[index:]...)
+	memory.compacted = revision
+}
+
+// WatchContext ..
+func (memory *MemoryKV) WatchContext(ctx context.Context, key string, handler func(key string, value []byte)) *Watcher {
+	return memory.watch(ctx, key, false, valueHandler(handler))
+}
+
+// WatchWithPrefixContext ..
+func (memory *MemoryKV) WatchWithPrefixContext(ctx context.Context, key string, handler func(key string, value []byte)) *Watcher {
+	return memory.watch(ctx, key, true, valueHandler(handler))
+}
+
+// WatchEventsContext ..
+func (memory *MemoryKV) WatchEventsContext(ctx context.Context, key string, handler func(event Event)) *Watcher {
+	return memory.watch(ctx, key, false, handler)
+}
+
+// WatchEventsWithPrefixContext ..
+func (memory *MemoryKV) WatchEventsWithPrefixContext(ctx context.Context, key string, handler func(event Event)) *Watcher {
+	return memory.watch(ctx, key, true, handler)
+}
+
+// WatchEventsFromContext ..
+func (memory *MemoryKV) WatchEventsFromContext(ctx context.Context, key string, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	return memory.watchFrom(ctx, key, false, revision, handler, compacted)
+}
+
+// WatchEventsWithPrefixFromContext ..
+func (memory *MemoryKV) WatchEventsWithPrefixFromContext(ctx context.Context, key string, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	return memory.watchFrom(ctx, key, true, revision, handler, compacted)
+}
+
+func (memory *MemoryKV) watch(ctx context.Context, key string, prefix bool, handler func(event Event)) *Watcher {
+	return memory.watchFrom(ctx, key, prefix, 0, handler, nil)
+}
+
+func (memory *MemoryKV) watchFrom(ctx context.Context, key string, prefix bool, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	watch := newMemoryWatch(key, prefix)
+
+	memory.mutex.Lock()
+	if err := memory.check(ctx); err != nil {
+		watch.close()
+	} else if revision > 0 && revision < memory.compacted {
+		watch.push(clientv3.WatchResponse{CompactRevision: memory.compacted})
+	} else {
+		if revision > 0 {
+			for _, event := range memory.history {
+				if event.Kv.ModRevision >= revision && watch.matches(string(event.Kv.Key)) {
+					watch.push(clientv3.WatchResponse{Events: []*clientv3.Event{(*clientv3.Event)(event)}})
+				}
+			}
+		}
+		memory.watches[watch] = true
+	}
+	memory.mutex.Unlock()
+
+	go watch.run()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-watchCtx.Done()
+		memory.mutex.Lock()
+		delete(memory.watches, watch)
+		memory.mutex.Unlock()
+		watch.close()
+	}()
+
+	watcher := newWatcher(key, watch.out, handler, compacted, cancel)
+	go func() {
+		watcher.start()
+	}()
+	return watcher
+}
+
+// notify must be called with lock held, so events are queued in revision order.
+func (memory *MemoryKV) notify(event *mvccpb.Event) {
+	memory.history = append(memory.history, event)
+	if len(memory.history) > memoryHistoryLimit {
+		memory.compact(memory.history[len(memory.history)-memoryHistoryLimit].Kv.ModRevision)
+	}
+
+	for watch := range memory.watches {
+		if watch.matches(string(event.Kv.Key)) {
+			watch.push(clientv3.WatchResponse{Events: []*clientv3.Event{(*clientv3.Event)(event)}})
+		}
+	}
+}
+
+// memoryWatch queues events for one watcher, so a slow handler never blocks writers.
+type memoryWatch struct {
+	key    string
+	prefix bool
+	mutex  sync.Mutex
+	queue  []clientv3.WatchResponse
+	notify chan struct{}
+	done   chan struct{}
+	closed bool
+	out    chan clientv3.WatchResponse
+}
+
+func newMemoryWatch(key string, prefix bool) *memoryWatch {
+	watch := memoryWatch{key: key, prefix: prefix}
+	watch.notify = make(chan struct{}, 1)
+	watch.done = make(chan struct{})
+	watch.out = make(chan clientv3.WatchResponse)
+	return &watch
+}
+
+func (watch *memoryWatch) matches(key string) bool {
+	if watch.prefix {
+		return strings.HasPrefix(key, watch.key)
+	}
+	return key == watch.key
+}
+
+func (watch *memoryWatch) push(resp clientv3.WatchResponse) {
+	watch.mutex.Lock()
+	if !watch.closed {
+		watch.queue = append(watch.queue, resp)
+	}
+	watch.mutex.Unlock()
+
+	select {
+	case watch.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (watch *memoryWatch) close() {
+	watch.mutex.Lock()
+	defer watch.mutex.Unlock()
+
+	if !watch.closed {
+		watch.closed = true
+		close(watch.done)
+	}
+}
+
+func (watch *memoryWatch) run() {
+	defer close(watch.out)
+
+	for {
+		watch.mutex.Lock()
+		if watch.closed {
+			watch.mutex.Unlock()
+			return
+		}
+		if len(watch.queue) == 0 {
+			watch.mutex.Unlock()
+			select {
+			case <-watch.notify:
+			case <-watch.done:
+			}
+			continue
+		}
+		resp := watch.queue[0]
+		watch.queue = watch.queue[1:]
+		watch.mutex.Unlock()
+
+		select {
+		case watch.out <- resp:
+		case <-watch.done:
+			return
+		}
+	}
+}
+
+func copyBytes(src []byte) []byte {
+	if src == nil {
+		return nil
+	}
+	dst := make([]byte, len(src))
+	copy(dst, src)
+	return dst
+}
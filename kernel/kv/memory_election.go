@@ -0,0 +1,168 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// memoryElection implements Election on MemoryKV, same as clientv3/concurrency does on etcd
+type memoryElection struct {
+	memory *MemoryKV
+	prefix string
+	lease  LeaseID
+	done   chan struct{}
+	mutex  sync.Mutex
+	key    string
+}
+
+// NewElection : Create an election candidate with its own session of ttl seconds
+func (memory *MemoryKV) NewElection(name string, ttl int64) (election Election, err error) {
+	lease, err := memory.GrantLease(ttl)
+	if err != nil {
+		return nil, err
+	}
+	err = memory.KeepAlive(lease)
+	if err != nil {
+		return nil, err
+	}
+
+	memory.mutex.Lock()
+	done := memory.leases[lease].done
+	memory.mutex.Unlock()
+
+	return &memoryElection{memory: memory, prefix: name + "/", lease: lease, done: done}, nil
+}
+
+// Campaign ..
+func (election *memoryElection) Campaign(ctx context.Context, value string) (term int64, err error) {
+	memory := election.memory
+	key := fmt.Sprintf("%s%x", election.prefix, int64(election.lease))
+
+	memory.mutex.Lock()
+	if err := memory.check(ctx); err != nil {
+		memory.mutex.Unlock()
+		return 0, err
+	}
+	if memory.leases[election.lease] == nil {
+		memory.mutex.Unlock()
+		return 0, ErrLeaseNotFound
+	}
+	memory.revision++
+	memory.put(key, value, election.lease)
+	term = memory.items[key].CreateRevision
+	memory.mutex.Unlock()
+
+	election.mutex.Lock()
+	election.key = key
+	election.mutex.Unlock()
+
+	for {
+		memory.mutex.Lock()
+		leader := memory.firstCreated(election.prefix)
+		revision := memory.revision
+		memory.mutex.Unlock()
+
+		if leader == nil {
+			return 0, ErrLeaseNotFound
+		}
+		if string(leader.Key) == key {
+			return term, nil
+		}
+
+		// wait until the leader key is deleted, then check again
+		deleted := make(chan struct{}, 1)
+		signal := func() {
+			select {
+			case deleted <- struct{}{}:
+			default:
+			}
+		}
+		watchCtx, cancel := context.WithCancel(ctx)
+		memory.WatchEventsFromContext(watchCtx, string(leader.Key), revision+1,
+			func(event Event) {
+				if event.Type == EventDelete {
+					signal()
+				}
+			},
+			func(compactRevision int64) {
+				signal()
+			})
+
+		select {
+		case <-deleted:
+			cancel()
+		case <-election.done:
+			cancel()
+			return 0, ErrLeaseNotFound
+		case <-ctx.Done():
+			cancel()
+			election.Resign(context.Background())
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// Resign ..
+func (election *memoryElection) Resign(ctx context.Context) (err error) {
+	election.mutex.Lock()
+	key := election.key
+	election.key = ""
+	election.mutex.Unlock()
+
+	if key == "" {
+		return nil
+	}
+	_, _, err = election.memory.TxnContext(ctx, []Compare{KeyExists(key)}, []Op{OpDelete(key)})
+	return err
+}
+
+// Leader ..
+func (election *memoryElection) Leader(ctx context.Context) (value string, term int64, err error) {
+	memory := election.memory
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := memory.check(ctx); err != nil {
+		return "", 0, err
+	}
+	leader := memory.firstCreated(election.prefix)
+	if leader == nil {
+		return "", 0, ErrNoLeader
+	}
+	return string(leader.Value), leader.CreateRevision, nil
+}
+
+// Key ..
+func (election *memoryElection) Key() string {
+	election.mutex.Lock()
+	defer election.mutex.Unlock()
+	return election.key
+}
+
+// Done ..
+func (election *memoryElection) Done() <-chan struct{} {
+	return election.done
+}
+
+// Close ..
+func (election *memoryElection) Close() error {
+	err := election.memory.RevokeLease(election.lease)
+	if err == ErrLeaseNotFound {
+		return nil
+	}
+	return err
+}
+
+// firstCreated must be called with lock held. It returns the item created first under prefix.
+func (memory *MemoryKV) firstCreated(prefix string) *mvccpb.KeyValue {
+	var first *mvccpb.KeyValue
+	for _, item := range memory.rangePrefix(prefix, 0) {
+		if first == nil || item.CreateRevision < first.CreateRevision {
+			first = item
+		}
+	}
+	return first
+}
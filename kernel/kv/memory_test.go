@@ -0,0 +1,188 @@
+package kv
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryPrefix(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	for _, key := range []string{"a/1", "a/2", "a/3", "ab", "b/1"} {
+		if _, err := store.Put(key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := []string{}
+	if err := store.GetWithPrefixLimit("a/", 2, func(key string, value []byte) {
+		keys = append(keys, key)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "a/1" || keys[1] != "a/2" {
+		t.Fatal("limited prefix get", keys)
+	}
+
+	keys = []string{}
+	store.GetWithPrefix("a/", func(key string, value []byte) {
+		keys = append(keys, key)
+	})
+	if len(keys) != 3 {
+		t.Fatal("prefix get", keys)
+	}
+
+	deleted, err := store.DeleteWithPrefix("a/")
+	if err != nil || deleted != 3 {
+		t.Fatal("prefix delete", deleted, err)
+	}
+	if _, err = store.GetOne("ab"); err != nil {
+		t.Fatal("key out of prefix is deleted", err)
+	}
+}
+
+func TestMemoryNotFound(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	if _, err := store.GetOne("none"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("missing key must be ErrNotFound", err)
+	}
+	revision, _ := store.Put("other", "v")
+	_, storeRevision, err := store.GetOneWithStoreRevision("none")
+	if !errors.Is(err, ErrNotFound) || storeRevision != revision {
+		t.Fatal("store revision of missing key", storeRevision, revision, err)
+	}
+}
+
+func TestMemoryRevisions(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	rev1, _ := store.Put("k", "1")
+	rev2, _ := store.Put("k", "2")
+	if rev2 != rev1+1 {
+		t.Fatal("revision is not increased", rev1, rev2)
+	}
+	value, modRevision, err := store.GetOneWithRevision("k")
+	if err != nil || string(value) != "2" || modRevision != rev2 {
+		t.Fatal("mod revision", string(value), modRevision, err)
+	}
+
+	// all ops of a transaction share one revision
+	_, rev3, err := store.Txn(nil, []Op{OpPut("x", "1"), OpPut("y", "1")})
+	if err != nil || rev3 != rev2+1 {
+		t.Fatal("txn revision", rev3, err)
+	}
+	_, revX, _ := store.GetOneWithRevision("x")
+	_, revY, _ := store.GetOneWithRevision("y")
+	if revX != rev3 || revY != rev3 {
+		t.Fatal("txn ops have different revisions", revX, revY)
+	}
+}
+
+func TestMemoryTxnCompare(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	revision, _ := store.Put("k", "1")
+	succeeded, _, err := store.Txn([]Compare{ModRevisionEquals("k", revision+1)}, []Op{OpPut("k", "2")})
+	if err != nil || succeeded {
+		t.Fatal("txn with failed compare must not succeed", succeeded, err)
+	}
+	if value, _ := store.GetOne("k"); string(value) != "1" {
+		t.Fatal("txn with failed compare wrote", string(value))
+	}
+
+	succeeded, _, err = store.Txn([]Compare{ModRevisionEquals("k", revision)}, []Op{OpPut("k", "2")})
+	if err != nil || !succeeded {
+		t.Fatal("txn failed", succeeded, err)
+	}
+	if value, _ := store.GetOne("k"); string(value) != "2" {
+		t.Fatal("txn did not write", string(value))
+	}
+}
+
+func TestMemoryWatchEvents(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	events := make(chan Event, 10)
+	watcher := store.WatchEventsWithPrefix("w/", func(event Event) {
+		events <- event
+	})
+	defer watcher.Stop()
+
+	store.Put("w/1", "v")
+	store.Put("other", "v")
+	store.DeleteOne("w/1")
+
+	expected := []EventType{EventPut, EventDelete}
+	for _, eventType := range expected {
+		select {
+		case event := <-events:
+			if event.Type != eventType || event.Key != "w/1" {
+				t.Fatal("unexpected event", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("event is not delivered", eventType)
+		}
+	}
+}
+
+func TestMemoryLeaseExpiry(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	lease, err := store.GrantLease(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.PutWithLease("leased", "v", lease); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, err = store.GetOne("leased"); errors.Is(err, ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key is not deleted when its lease expired", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err = store.KeepAliveOnce(lease); err != ErrLeaseNotFound {
+		t.Fatal("expired lease must not be found", err)
+	}
+}
+
+func TestMemoryWatchCompacted(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	first, _ := store.Put("k", "1")
+	last, _ := store.Put("k", "2")
+	if err := store.Compact(last); err != nil {
+		t.Fatal(err)
+	}
+
+	compacted := make(chan int64, 1)
+	watcher := store.WatchEventsFrom("k", first, func(event Event) {
+		t.Error("event from compacted revision", event)
+	}, func(compactRevision int64) {
+		compacted <- compactRevision
+	})
+	defer watcher.Stop()
+
+	select {
+	case revision := <-compacted:
+		if revision != last {
+			t.Fatal("compact revision", revision, last)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("compacted is not called")
+	}
+}
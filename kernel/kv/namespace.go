@@ -0,0 +1,288 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrConfined returned when a confined view compacts, creates an election, or uses a lease it did not grant
+var ErrConfined = errors.New("Not allowed in a confined KV view")
+
+// namespaceKV is a view of KV confined to keys under prefix.
+// Keys are prefixed on the way in and stripped on the way out.
+type namespaceKV struct {
+	defaultContext
+	kv     KV
+	prefix string
+	// confined views cannot touch the store outside prefix. leases holds leases granted by them.
+	confined bool
+	leases   *leaseSet
+}
+
+// leaseSet : leases granted through a confined view and its children
+type leaseSet struct {
+	mutex  sync.Mutex
+	leases map[LeaseID]bool
+}
+
+func (set *leaseSet) add(lease LeaseID) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.leases[lease] = true
+}
+
+func (set *leaseSet) remove(lease LeaseID) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	delete(set.leases, lease)
+}
+
+func (set *leaseSet) has(lease LeaseID) bool {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return set.leases[lease]
+}
+
+// NewNamespace : Create a KV view whose keys are all under prefix.
+// Closing the view does not close the underlying KV.
+func NewNamespace(kv KV, prefix string) KV {
+	namespace := namespaceKV{kv: kv, prefix: prefix}
+	if parent, ok := kv.(*namespaceKV); ok {
+		namespace.kv = parent.kv
+		namespace.prefix = parent.prefix + prefix
+		namespace.confined = parent.confined
+		namespace.leases = parent.leases
+	}
+
+	timeout := DefaultRequestTimeout
+	if base, ok := namespace.kv.(interface{ requestTimeout() time.Duration }); ok {
+		timeout = base.requestTimeout()
+	}
+	namespace.defaultContext = defaultContext{kv: &namespace, timeout: timeout}
+	return &namespace
+}
+
+// NewConfinedNamespace : Create a KV view whose keys are all under prefix, and which cannot affect
+// the store outside prefix. Compaction and elections fail with ErrConfined, and so do keepalive, revoke
+// and puts with leases which are not granted through the view. Views created on it are confined too.
+func NewConfinedNamespace(kv KV, prefix string) KV {
+	namespace := NewNamespace(kv, prefix).(*namespaceKV)
+	if !namespace.confined {
+		namespace.confined = true
+		namespace.leases = &leaseSet{leases: make(map[LeaseID]bool)}
+	}
+	return namespace
+}
+
+// checkLease fails if a confined view uses a lease granted by others
+func (namespace *namespaceKV) checkLease(lease LeaseID) error {
+	if namespace.confined && lease != NoLease && !namespace.leases.has(lease) {
+		return ErrConfined
+	}
+	return nil
+}
+
+func (namespace *namespaceKV) key(key string) string {
+	return namespace.prefix + key
+}
+
+func (namespace *namespaceKV) strip(key string) string {
+	return key[len(namespace.prefix):]
+}
+
+func (namespace *namespaceKV) stripHandler(handler func(key string, value []byte)) func(key string, value []byte) {
+	return func(key string, value []byte) {
+		handler(namespace.strip(key), value)
+	}
+}
+
+func (namespace *namespaceKV) stripEventHandler(handler func(event Event)) func(event Event) {
+	return func(event Event) {
+		event.Key = namespace.strip(event.Key)
+		handler(event)
+	}
+}
+
+// Close : the underlying KV stays open
+func (namespace *namespaceKV) Close() error {
+	return nil
+}
+
+// PutObjectContext ..
+func (namespace *namespaceKV) PutObjectContext(ctx context.Context, key string, value interface{}) (revision int64, err error) {
+	return namespace.kv.PutObjectContext(ctx, namespace.key(key), value)
+}
+
+// PutContext ..
+func (namespace *namespaceKV) PutContext(ctx context.Context, key, val string) (revision int64, err error) {
+	return namespace.kv.PutContext(ctx, namespace.key(key), val)
+}
+
+// PutWithLeaseContext ..
+func (namespace *namespaceKV) PutWithLeaseContext(ctx context.Context, key, val string, lease LeaseID) (revision int64, err error) {
+	if err = namespace.checkLease(lease); err != nil {
+		return 0, err
+	}
+	return namespace.kv.PutWithLeaseContext(ctx, namespace.key(key), val, lease)
+}
+
+// GetOneContext ..
+func (namespace *namespaceKV) GetOneContext(ctx context.Context, key string) (value []byte, err error) {
+	return namespace.kv.GetOneContext(ctx, namespace.key(key))
+}
+
+// GetOneWithRevisionContext ..
+func (namespace *namespaceKV) GetOneWithRevisionContext(ctx context.Context, key string) (value []byte, modRevision int64, err error) {
+	return namespace.kv.GetOneWithRevisionContext(ctx, namespace.key(key))
+}
+
+// GetOneWithStoreRevisionContext ..
+func (namespace *namespaceKV) GetOneWithStoreRevisionContext(ctx context.Context, key string) (value []byte, revision int64, err error) {
+	return namespace.kv.GetOneWithStoreRevisionContext(ctx, namespace.key(key))
+}
+
+// GetObjectContext ..
+func (namespace *namespaceKV) GetObjectContext(ctx context.Context, key string, obj interface{}) (err error) {
+	return namespace.kv.GetObjectContext(ctx, namespace.key(key), obj)
+}
+
+// GetWithPrefixContext ..
+func (namespace *namespaceKV) GetWithPrefixContext(ctx context.Context, key string, handler func(key string, value []byte)) (err error) {
+	return namespace.kv.GetWithPrefixContext(ctx, namespace.key(key), namespace.stripHandler(handler))
+}
+
+// GetWithPrefixLimitContext ..
+func (namespace *namespaceKV) GetWithPrefixLimitContext(ctx context.Context, key string, limit int64, handler func(key string, value []byte)) (err error) {
+	return namespace.kv.GetWithPrefixLimitContext(ctx, namespace.key(key), limit, namespace.stripHandler(handler))
+}
+
+// GetWithPrefixRevisionContext ..
+func (namespace *namespaceKV) GetWithPrefixRevisionContext(ctx context.Context, key string, handler func(key string, value []byte)) (revision int64, err error) {
+	return namespace.kv.GetWithPrefixRevisionContext(ctx, namespace.key(key), namespace.stripHandler(handler))
+}
+
+// DeleteOneContext ..
+func (namespace *namespaceKV) DeleteOneContext(ctx context.Context, key string) (deleted bool, err error) {
+	return namespace.kv.DeleteOneContext(ctx, namespace.key(key))
+}
+
+// DeleteWithPrefixContext ..
+func (namespace *namespaceKV) DeleteWithPrefixContext(ctx context.Context, key string) (deleted int64, err error) {
+	return namespace.kv.DeleteWithPrefixContext(ctx, namespace.key(key))
+}
+
+// WatchContext ..
+func (namespace *namespaceKV) WatchContext(ctx context.Context, key string, handler func(key string, value []byte)) *Watcher {
+	return namespace.kv.WatchContext(ctx, namespace.key(key), namespace.stripHandler(handler))
+}
+
+// WatchWithPrefixContext ..
+func (namespace *namespaceKV) WatchWithPrefixContext(ctx context.Context, key string, handler func(key string, value []byte)) *Watcher {
+	return namespace.kv.WatchWithPrefixContext(ctx, namespace.key(key), namespace.stripHandler(handler))
+}
+
+// WatchEventsContext ..
+func (namespace *namespaceKV) WatchEventsContext(ctx context.Context, key string, handler func(event Event)) *Watcher {
+	return namespace.kv.WatchEventsContext(ctx, namespace.key(key), namespace.stripEventHandler(handler))
+}
+
+// WatchEventsWithPrefixContext ..
+func (namespace *namespaceKV) WatchEventsWithPrefixContext(ctx context.Context, key string, handler func(event Event)) *Watcher {
+	return namespace.kv.WatchEventsWithPrefixContext(ctx, namespace.key(key), namespace.stripEventHandler(handler))
+}
+
+// WatchEventsFromContext ..
+func (namespace *namespaceKV) WatchEventsFromContext(ctx context.Context, key string, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	return namespace.kv.WatchEventsFromContext(ctx, namespace.key(key), revision, namespace.stripEventHandler(handler), compacted)
+}
+
+// WatchEventsWithPrefixFromContext ..
+func (namespace *namespaceKV) WatchEventsWithPrefixFromContext(ctx context.Context, key string, revision int64, handler func(event Event),
+	compacted func(compactRevision int64)) *Watcher {
+	return namespace.kv.WatchEventsWithPrefixFromContext(ctx, namespace.key(key), revision, namespace.stripEventHandler(handler), compacted)
+}
+
+// CompactContext .. Confined views cannot compact the store.
+func (namespace *namespaceKV) CompactContext(ctx context.Context, revision int64) (err error) {
+	if namespace.confined {
+		return ErrConfined
+	}
+	return namespace.kv.CompactContext(ctx, revision)
+}
+
+// TxnContext ..
+func (namespace *namespaceKV) TxnContext(ctx context.Context, compares []Compare, ops []Op) (succeeded bool, revision int64, err error) {
+	prefixedCompares := []Compare{}
+	for _, compare := range compares {
+		compare.Key = namespace.key(compare.Key)
+		prefixedCompares = append(prefixedCompares, compare)
+	}
+
+	prefixedOps := []Op{}
+	for _, op := range ops {
+		if err = namespace.checkLease(op.lease); err != nil {
+			return false, 0, err
+		}
+		op.Key = namespace.key(op.Key)
+		prefixedOps = append(prefixedOps, op)
+	}
+
+	return namespace.kv.TxnContext(ctx, prefixedCompares, prefixedOps)
+}
+
+// GrantLeaseContext ..
+func (namespace *namespaceKV) GrantLeaseContext(ctx context.Context, ttl int64) (lease LeaseID, err error) {
+	lease, err = namespace.kv.GrantLeaseContext(ctx, ttl)
+	if err == nil && namespace.confined {
+		namespace.leases.add(lease)
+	}
+	return lease, err
+}
+
+// KeepAliveContext ..
+func (namespace *namespaceKV) KeepAliveContext(ctx context.Context, lease LeaseID) (err error) {
+	if err = namespace.checkLease(lease); err != nil {
+		return err
+	}
+	return namespace.kv.KeepAliveContext(ctx, lease)
+}
+
+// KeepAliveOnceContext ..
+func (namespace *namespaceKV) KeepAliveOnceContext(ctx context.Context, lease LeaseID) (err error) {
+	if err = namespace.checkLease(lease); err != nil {
+		return err
+	}
+	return namespace.kv.KeepAliveOnceContext(ctx, lease)
+}
+
+// RevokeLeaseContext ..
+func (namespace *namespaceKV) RevokeLeaseContext(ctx context.Context, lease LeaseID) (err error) {
+	if err = namespace.checkLease(lease); err != nil {
+		return err
+	}
+	err = namespace.kv.RevokeLeaseContext(ctx, lease)
+	if err == nil && namespace.confined {
+		namespace.leases.remove(lease)
+	}
+	return err
+}
+
+// PingContext ..
+func (namespace *namespaceKV) PingContext(ctx context.Context) (err error) {
+	return namespace.kv.PingContext(ctx)
+}
+
+// NewElection : election named under the namespace. Confined views cannot create elections.
+func (namespace *namespaceKV) NewElection(name string, ttl int64) (election Election, err error) {
+	if namespace.confined {
+		return nil, ErrConfined
+	}
+	election, err = namespace.kv.NewElection(namespace.key(name), ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &namespaceElection{Election: election, namespace: namespace}, nil
+}
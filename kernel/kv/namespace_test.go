@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"testing"
+)
+
+func TestNamespacePrefix(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	namespace := NewNamespace(store, "/jobs/x/")
+	if _, err := namespace.Put("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	value, err := store.GetOne("/jobs/x/a")
+	if err != nil || string(value) != "1" {
+		t.Fatal("key is not prefixed", string(value), err)
+	}
+
+	keys := []string{}
+	namespace.GetWithPrefix("", func(key string, value []byte) {
+		keys = append(keys, key)
+	})
+	if len(keys) != 1 || keys[0] != "a" {
+		t.Fatal("key is not stripped", keys)
+	}
+}
+
+func TestConfinedNamespace(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	for i := 0; i < 3; i++ {
+		store.Put("other", "v")
+	}
+	otherLease, err := store.GrantLease(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confined := NewConfinedNamespace(store, "/jobs/x/")
+	if err := confined.Compact(2); err != ErrConfined {
+		t.Fatal("confined view compacted the store", err)
+	}
+	if _, err := confined.NewElection("e", 10); err != ErrConfined {
+		t.Fatal("confined view created an election", err)
+	}
+	if err := confined.RevokeLease(otherLease); err != ErrConfined {
+		t.Fatal("confined view revoked a lease of others", err)
+	}
+	if err := confined.KeepAliveOnce(otherLease); err != ErrConfined {
+		t.Fatal("confined view kept a lease of others alive", err)
+	}
+	if _, err := confined.PutWithLease("a", "1", otherLease); err != ErrConfined {
+		t.Fatal("confined view put with a lease of others", err)
+	}
+	if _, _, err := confined.Txn(nil, []Op{OpPutWithLease("a", "1", otherLease)}); err != ErrConfined {
+		t.Fatal("confined view put with a lease of others in txn", err)
+	}
+
+	// leases granted through the view and its children are usable
+	child := NewNamespace(confined, "sub/")
+	lease, err := confined.GrantLease(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := child.PutWithLease("a", "1", lease); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.Compact(2); err != ErrConfined {
+		t.Fatal("child of confined view compacted the store", err)
+	}
+	if err := child.RevokeLease(lease); err != nil {
+		t.Fatal(err)
+	}
+	if err := confined.KeepAliveOnce(lease); err != ErrConfined {
+		t.Fatal("revoked lease is still granted to the view", err)
+	}
+
+	// the store and plain namespaces are not confined
+	if err := NewNamespace(store, "/jobs/x/").Compact(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeLease(otherLease); err != nil {
+		t.Fatal(err)
+	}
+}
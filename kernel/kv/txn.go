@@ -0,0 +1,161 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+type compareTarget int
+
+const (
+	compareValue compareTarget = iota
+	compareModRevision
+	compareCreateRevision
+)
+
+// Compare : condition of a transaction
+type Compare struct {
+	Key      string
+	target   compareTarget
+	result   string
+	value    string
+	revision int64
+}
+
+// ValueEquals : key's value is equal to value
+func ValueEquals(key, value string) Compare {
+	return Compare{Key: key, target: compareValue, result: "=", value: value}
+}
+
+// ModRevisionEquals : key's last modified revision is equal to revision
+func ModRevisionEquals(key string, revision int64) Compare {
+	return Compare{Key: key, target: compareModRevision, result: "=", revision: revision}
+}
+
+// CreateRevisionEquals : key is created at revision, and not deleted since
+func CreateRevisionEquals(key string, revision int64) Compare {
+	return Compare{Key: key, target: compareCreateRevision, result: "=", revision: revision}
+}
+
+// KeyExists : key exists
+func KeyExists(key string) Compare {
+	return Compare{Key: key, target: compareCreateRevision, result: ">", revision: 0}
+}
+
+// KeyMissing : key does not exist
+func KeyMissing(key string) Compare {
+	return Compare{Key: key, target: compareCreateRevision, result: "=", revision: 0}
+}
+
+func (compare Compare) toCmp() clientv3.Cmp {
+	switch compare.target {
+	case compareValue:
+		return clientv3.Compare(clientv3.Value(compare.Key), compare.result, compare.value)
+	case compareModRevision:
+		return clientv3.Compare(clientv3.ModRevision(compare.Key), compare.result, compare.revision)
+	default:
+		return clientv3.Compare(clientv3.CreateRevision(compare.Key), compare.result, compare.revision)
+	}
+}
+
+// evaluate follows etcd : value comparison on a missing key always fails,
+// revision comparisons treat a missing key as revision 0.
+func (compare Compare) evaluate(item *mvccpb.KeyValue) bool {
+	var result int
+	switch compare.target {
+	case compareValue:
+		if item == nil {
+			return false
+		}
+		result = bytes.Compare(item.Value, []byte(compare.value))
+	case compareModRevision:
+		result = compareInt64(revisionOf(item, false), compare.revision)
+	default:
+		result = compareInt64(revisionOf(item, true), compare.revision)
+	}
+
+	switch compare.result {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case "<":
+		return result < 0
+	}
+	return false
+}
+
+func revisionOf(item *mvccpb.KeyValue, create bool) int64 {
+	if item == nil {
+		return 0
+	}
+	if create {
+		return item.CreateRevision
+	}
+	return item.ModRevision
+}
+
+func compareInt64(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+type opType int
+
+const (
+	opPut opType = iota
+	opDelete
+	opDeleteWithPrefix
+)
+
+// Op : put/delete operation of a transaction
+type Op struct {
+	Key   string
+	typ   opType
+	value string
+	lease LeaseID
+}
+
+// OpPut ..
+func OpPut(key, val string) Op {
+	return Op{Key: key, typ: opPut, value: val}
+}
+
+// OpPutObject ..
+func OpPutObject(key string, value interface{}) (Op, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return Op{}, err
+	}
+	return OpPut(key, string(bytes)), nil
+}
+
+// OpDelete ..
+func OpDelete(key string) Op {
+	return Op{Key: key, typ: opDelete}
+}
+
+// OpDeleteWithPrefix ..
+func OpDeleteWithPrefix(key string) Op {
+	return Op{Key: key, typ: opDeleteWithPrefix}
+}
+
+func (op Op) toOp() clientv3.Op {
+	switch op.typ {
+	case opPut:
+		return clientv3.OpPut(op.Key, op.value, leaseOption(op.lease)...)
+	case opDelete:
+		return clientv3.OpDelete(op.Key)
+	default:
+		return clientv3.OpDelete(op.Key, clientv3.WithPrefix())
+	}
+}
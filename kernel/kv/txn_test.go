@@ -0,0 +1,155 @@
+package kv
+
+import (
+	"testing"
+
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+)
+
+func TestTxnCompareAndSwap(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	store.Put("k", "1")
+	succeeded, _, err := store.Txn([]Compare{ValueEquals("k", "2")}, []Op{OpPut("k", "3")})
+	if err != nil || succeeded {
+		t.Fatal("swap with unequal value must fail", succeeded, err)
+	}
+	succeeded, _, err = store.Txn([]Compare{ValueEquals("k", "1")}, []Op{OpPut("k", "3")})
+	if err != nil || !succeeded {
+		t.Fatal("swap with equal value failed", succeeded, err)
+	}
+	if value, _ := store.GetOne("k"); string(value) != "3" {
+		t.Fatal("value is not swapped", string(value))
+	}
+
+	// value comparison on a missing key always fails
+	succeeded, _, _ = store.Txn([]Compare{ValueEquals("none", "")}, []Op{OpPut("none", "v")})
+	if succeeded {
+		t.Fatal("value comparison on missing key must fail")
+	}
+}
+
+func TestTxnKeyExistence(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	succeeded, _, err := store.Txn([]Compare{KeyMissing("k")}, []Op{OpPut("k", "1")})
+	if err != nil || !succeeded {
+		t.Fatal("create of missing key failed", succeeded, err)
+	}
+	succeeded, _, _ = store.Txn([]Compare{KeyMissing("k")}, []Op{OpPut("k", "2")})
+	if succeeded {
+		t.Fatal("create of existing key must fail")
+	}
+
+	succeeded, _, err = store.Txn([]Compare{KeyExists("k")}, []Op{OpDelete("k")})
+	if err != nil || !succeeded {
+		t.Fatal("delete of existing key failed", succeeded, err)
+	}
+	succeeded, _, _ = store.Txn([]Compare{KeyExists("k")}, []Op{OpPut("k", "3")})
+	if succeeded {
+		t.Fatal("update of missing key must fail")
+	}
+}
+
+func TestTxnCreateRevision(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	created, _ := store.Put("election", "a")
+	store.Put("election", "b")
+
+	// updates keep create revision
+	succeeded, _, _ := store.Txn([]Compare{CreateRevisionEquals("election", created)}, []Op{OpPut("x", "1")})
+	if !succeeded {
+		t.Fatal("create revision is changed by update")
+	}
+
+	store.DeleteOne("election")
+	store.Put("election", "c")
+	succeeded, _, _ = store.Txn([]Compare{CreateRevisionEquals("election", created)}, []Op{OpPut("x", "2")})
+	if succeeded {
+		t.Fatal("recreated key must have new create revision")
+	}
+}
+
+func TestTxnAllOrNothing(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+
+	store.Put("a/1", "1")
+	store.Put("a/2", "2")
+	revision, _ := store.Put("guard", "g")
+
+	op, err := OpPutObject("obj", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []Op{op, OpDeleteWithPrefix("a/"), OpPut("b", "1")}
+
+	succeeded, _, _ := store.Txn([]Compare{ModRevisionEquals("guard", revision), KeyExists("none")}, ops)
+	if succeeded {
+		t.Fatal("txn must fail when one compare fails")
+	}
+	if _, err = store.GetOne("b"); err == nil {
+		t.Fatal("ops of failed txn are applied")
+	}
+
+	succeeded, _, err = store.Txn([]Compare{ModRevisionEquals("guard", revision), KeyMissing("none")}, ops)
+	if err != nil || !succeeded {
+		t.Fatal("txn failed", succeeded, err)
+	}
+	obj := map[string]int{}
+	if err = store.GetObject("obj", &obj); err != nil || obj["n"] != 1 {
+		t.Fatal("object is not put", obj, err)
+	}
+	keys := 0
+	store.GetWithPrefix("a/", func(key string, value []byte) { keys++ })
+	if keys != 0 {
+		t.Fatal("prefix is not deleted", keys)
+	}
+}
+
+func TestTxnNamespace(t *testing.T) {
+	store := NewMemory()
+	defer store.Close()
+	namespace := NewNamespace(store, "/ns/")
+
+	revision, _ := namespace.Put("k", "1")
+	succeeded, _, err := namespace.Txn([]Compare{ModRevisionEquals("k", revision)}, []Op{OpPut("k", "2")})
+	if err != nil || !succeeded {
+		t.Fatal("namespaced txn failed", succeeded, err)
+	}
+	if value, _ := store.GetOne("/ns/k"); string(value) != "2" {
+		t.Fatal("namespaced txn is not prefixed", string(value))
+	}
+}
+
+func TestTxnToEtcd(t *testing.T) {
+	cmp := ModRevisionEquals("k", 3).toCmp()
+	if string(cmp.Key) != "k" || cmp.Target != etcdserverpb.Compare_MOD || cmp.Result != etcdserverpb.Compare_EQUAL {
+		t.Fatal("mod revision compare", cmp)
+	}
+	cmp = KeyExists("k").toCmp()
+	if cmp.Target != etcdserverpb.Compare_CREATE || cmp.Result != etcdserverpb.Compare_GREATER {
+		t.Fatal("key exists compare", cmp)
+	}
+	cmp = ValueEquals("k", "v").toCmp()
+	if cmp.Target != etcdserverpb.Compare_VALUE || string(cmp.ValueBytes()) != "v" {
+		t.Fatal("value compare", cmp)
+	}
+
+	op := OpPut("k", "v").toOp()
+	if !op.IsPut() || string(op.KeyBytes()) != "k" || string(op.ValueBytes()) != "v" {
+		t.Fatal("put op", op)
+	}
+	op = OpDelete("k").toOp()
+	if !op.IsDelete() || len(op.RangeBytes()) != 0 {
+		t.Fatal("delete op", op)
+	}
+	op = OpDeleteWithPrefix("a/").toOp()
+	if !op.IsDelete() || string(op.RangeBytes()) != "a0" {
+		t.Fatal("prefix delete op", string(op.RangeBytes()))
+	}
+}
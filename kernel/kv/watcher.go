@@ -0,0 +1,113 @@
+package kv
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// EventType : type of watched change
+type EventType int
+
+const (
+	// EventPut key is created or updated
+	EventPut EventType = iota
+	// EventDelete key is deleted
+	EventDelete
+)
+
+func (eventType EventType) String() string {
+	if eventType == EventDelete {
+		return "DELETE"
+	}
+	return "PUT"
+}
+
+// Event : a watched change of a key
+type Event struct {
+	Type        EventType
+	Key         string
+	Value       []byte
+	PrevValue   []byte
+	ModRevision int64
+}
+
+func newEvent(ev *clientv3.Event) Event {
+	event := Event{Type: EventPut, Key: string(ev.Kv.Key), Value: ev.Kv.Value, ModRevision: ev.Kv.ModRevision}
+	if ev.Type == mvccpb.DELETE {
+		event.Type = EventDelete
+	}
+	if ev.PrevKv != nil {
+		event.PrevValue = ev.PrevKv.Value
+	}
+	return event
+}
+
+// valueHandler adapts key/value handler of Watch, WatchWithPrefix
+func valueHandler(handler func(key string, value []byte)) func(event Event) {
+	return func(event Event) {
+		handler(event.Key, event.Value)
+	}
+}
+
+// Watcher ..
+type Watcher struct {
+	Key          string
+	watchChannel clientv3.WatchChan
+	// running 1 while events are handled, read and written atomically
+	running      int32
+	handler      func(event Event)
+	compacted    func(compactRevision int64)
+	cancel       func()
+	done         chan struct{}
+	lastRevision int64
+}
+
+func newWatcher(key string, watchChannel clientv3.WatchChan, handler func(event Event),
+	compacted func(compactRevision int64), cancel func()) *Watcher {
+	watcher := Watcher{Key: key, watchChannel: watchChannel, running: 1, handler: handler,
+		compacted: compacted, cancel: cancel}
+	watcher.done = make(chan struct{})
+	return &watcher
+}
+
+func (watcher *Watcher) start() {
+	defer close(watcher.done)
+	defer watcher.cancel()
+
+	for watchResp := range watcher.watchChannel {
+		if watchResp.CompactRevision != 0 {
+			log.Println("[WARN] Watch revision is compacted ", watcher.Key, watchResp.CompactRevision)
+			atomic.StoreInt32(&watcher.running, 0)
+			if watcher.compacted != nil {
+				watcher.compacted(watchResp.CompactRevision)
+			}
+			return
+		}
+		for _, ev := range watchResp.Events {
+			if atomic.LoadInt32(&watcher.running) == 0 {
+				return
+			}
+			watcher.handler(newEvent(ev))
+			atomic.StoreInt64(&watcher.lastRevision, ev.Kv.ModRevision)
+		}
+	}
+}
+
+// LastRevision returns revision of the last handled event. 0 if nothing is handled yet.
+func (watcher *Watcher) LastRevision() int64 {
+	return atomic.LoadInt64(&watcher.lastRevision)
+}
+
+// Stop stop watching. The underlying watch is cancelled and the watcher goroutine ends.
+func (watcher *Watcher) Stop() {
+	atomic.StoreInt32(&watcher.running, 0)
+	watcher.cancel()
+}
+
+// Done is closed when the watcher goroutine ends
+func (watcher *Watcher) Done() <-chan struct{} {
+	return watcher.done
+}
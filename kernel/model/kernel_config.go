@@ -15,6 +15,17 @@ type Config struct {
 	Port     uint
 	DataDir  string
 	EtcdUrls []string
+	// Zone zone of member, for placement of jobs
+	Zone string
+	// Labels labels of member such as region, rpc provider or hardware class, for placement of jobs
+	Labels map[string]string
+	// Capacity max total weight of jobs of member. A job weighs 1 unless its worker factory weighs it.
+	// Zero is unlimited.
+	Capacity uint
+
+	// JobOrganizer name of the organizer distributing jobs to members (simple|placement|rendezvous|weighted)
+	JobOrganizer string
+
 	// HeartbeatInterval Heartbeat Interval
 	HeartbeatInterval uint
 
@@ -23,6 +34,47 @@ type Config struct {
 
 	// AliveThreasholdSecond Heartbeat time Threashold
 	AliveThreasholdSeconds uint
+
+	// HeartbeatLease attach heartbeat to a KV lease (TTL AliveThreasholdSeconds).
+	// Members are alive while their lease is alive, regardless of clock skew.
+	HeartbeatLease bool
+
+	// MemberRetentionSeconds records of members dead longer than MemberRetentionSeconds are removed
+	// by the leader. Zero keeps them.
+	MemberRetentionSeconds uint
+
+	// HandoffTimeoutSeconds jobs moving from an alive member wait until it releases them,
+	// at most HandoffTimeoutSeconds for a member which never acknowledges. Jobs of dead members move at once.
+	// Zero moves all jobs at once.
+	HandoffTimeoutSeconds uint
+
+	// KVRequestTimeout timeout of a KV request
+	KVRequestTimeout uint
+
+	// InMemoryKV use in-process KV store instead of ETCD (for tests and single-node runs)
+	InMemoryKV bool
+
+	// EmbeddedEtcd run ETCD server in process, named Name and stored under DataDir.
+	// EtcdUrls are ignored and the kernel connects to EtcdClientURLs.
+	EmbeddedEtcd bool
+
+	// EtcdClientURLs client urls of embedded ETCD
+	EtcdClientURLs []string
+
+	// EtcdPeerURLs peer urls of embedded ETCD
+	EtcdPeerURLs []string
+
+	// EtcdAdvertiseClientURLs client urls of embedded ETCD advertised to clients. EtcdClientURLs if empty.
+	EtcdAdvertiseClientURLs []string
+
+	// EtcdAdvertisePeerURLs peer urls of embedded ETCD advertised to peers. EtcdPeerURLs if empty.
+	EtcdAdvertisePeerURLs []string
+
+	// EtcdInitialCluster name=peerURL,... of embedded ETCD members to bootstrap or join
+	EtcdInitialCluster string
+
+	// EtcdClusterState "new" or "existing"
+	EtcdClusterState string
 }
 
 // ParseFlagConfig ..
@@ -32,10 +84,29 @@ func ParseFlagConfig() (config *Config) {
 	host := flag.String("exposed-host", "0.0.0.0", "host name/IP")
 	port := flag.Uint("port", 8080, "liesten port for daemon")
 	dataDir := flag.String("data-dir", "chain-data", "local data directory")
+	zone := flag.String("zone", "", "zone of member")
+	labels := flag.String("labels", "", "labels of member key=value,...")
+	capacity := flag.Uint("capacity", 0, "max total weight of jobs of member (0: unlimited)")
+	jobOrganizer := flag.String("job-organizer", "simple",
+		"organizer distributing jobs to members (simple|placement|rendezvous|weighted)")
 	etcdUrls := flag.String("etcd-urls", "", "etcd-urls,...")
 	heartbeatInterval := flag.Uint("heartbeat-interval", 2, "heartbeat interval(seconds)")
 	checkHeartbeatInterval := flag.Uint("heartbeat-check-interval", 3, "heartbeat check interval(seconds)")
 	aliveThreasholdSeconds := flag.Uint("alive-threashold", 7, "alive threashold seconds")
+	kvRequestTimeout := flag.Uint("kv-request-timeout", 5, "kv request timeout(seconds)")
+	memberRetentionSeconds := flag.Uint("member-retention", 3600, "seconds to keep records of dead members")
+	handoffTimeoutSeconds := flag.Uint("handoff-timeout", 30, "seconds to wait for a job released by previous member")
+	heartbeatLease := flag.Bool("heartbeat-lease", false, "decide member liveness with heartbeat lease expiry")
+	inMemoryKV := flag.Bool("in-memory-kv", false, "use in-memory kv store instead of etcd (single node)")
+	embeddedEtcd := flag.Bool("embedded-etcd", false, "run etcd server in process")
+	etcdClientURLs := flag.String("etcd-client-urls", "http://127.0.0.1:2379", "client urls of embedded etcd,...")
+	etcdPeerURLs := flag.String("etcd-peer-urls", "http://127.0.0.1:2380", "peer urls of embedded etcd,...")
+	etcdAdvertiseClientURLs := flag.String("etcd-advertise-client-urls", "",
+		"client urls of embedded etcd advertised to clients,... (etcd-client-urls if empty, required for wildcard addresses)")
+	etcdAdvertisePeerURLs := flag.String("etcd-advertise-peer-urls", "",
+		"peer urls of embedded etcd advertised to peers,... (etcd-peer-urls if empty, required for wildcard addresses)")
+	etcdInitialCluster := flag.String("etcd-initial-cluster", "", "embedded etcd members name=peer-url,...")
+	etcdClusterState := flag.String("etcd-cluster-state", "new", "embedded etcd cluster state (new|existing)")
 
 	flag.Parse()
 
@@ -45,6 +116,10 @@ func ParseFlagConfig() (config *Config) {
 	config.Hostname = *host
 	config.Port = *port
 	config.DataDir = *dataDir + "/" + *name
+	config.Zone = *zone
+	config.Labels = ParseLabels(*labels)
+	config.Capacity = *capacity
+	config.JobOrganizer = *jobOrganizer
 
 	if !strings.Contains(",", *etcdUrls) {
 		config.EtcdUrls = []string{*etcdUrls}
@@ -55,10 +130,44 @@ func ParseFlagConfig() (config *Config) {
 	config.HeartbeatInterval = *heartbeatInterval * uint(time.Second)
 	config.CheckHeartbeatInterval = *checkHeartbeatInterval * uint(time.Second)
 	config.AliveThreasholdSeconds = *aliveThreasholdSeconds
+	config.HeartbeatLease = *heartbeatLease
+	config.HandoffTimeoutSeconds = *handoffTimeoutSeconds
+	config.MemberRetentionSeconds = *memberRetentionSeconds
+	config.KVRequestTimeout = *kvRequestTimeout * uint(time.Second)
+	config.InMemoryKV = *inMemoryKV
+	config.EmbeddedEtcd = *embeddedEtcd
+	config.EtcdClientURLs = strings.Split(*etcdClientURLs, ",")
+	config.EtcdPeerURLs = strings.Split(*etcdPeerURLs, ",")
+	if *etcdAdvertiseClientURLs != "" {
+		config.EtcdAdvertiseClientURLs = strings.Split(*etcdAdvertiseClientURLs, ",")
+	}
+	if *etcdAdvertisePeerURLs != "" {
+		config.EtcdAdvertisePeerURLs = strings.Split(*etcdAdvertisePeerURLs, ",")
+	}
+	config.EtcdInitialCluster = *etcdInitialCluster
+	config.EtcdClusterState = *etcdClusterState
 
 	return config
 }
 
+// ParseLabels parses key=value,... into labels. A key without value has empty value.
+func ParseLabels(str string) (labels map[string]string) {
+	labels = make(map[string]string)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 {
+			labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		} else {
+			labels[kv[0]] = ""
+		}
+	}
+	return labels
+}
+
 // GetDaemonAddr ..
 func (config Config) GetDaemonAddr() string {
 	return config.Hostname + ":" + fmt.Sprint(config.Port)
@@ -0,0 +1,85 @@
+package kernel
+
+import (
+	"log"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/job"
+)
+
+// PlanRebalance runs the job organizer on current jobs and members without writing the result.
+// A full plan ignores current member jobs and distributes all jobs again.
+func (kernel *Kernel) PlanRebalance(full bool) (plan *job.Plan, err error) {
+	if kernel.jobOrganizer == nil {
+		return nil, ErrNoJobOrganizer
+	}
+
+	allJobs, err := kernel.jobManager.GetAllJobs()
+	if err != nil {
+		return nil, err
+	}
+	current, err := kernel.jobManager.GetAllMemberJobIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	membJobMap := make(map[string][]string)
+	for membID, jobIDs := range current {
+		if full {
+			membJobMap[membID] = []string{}
+		} else {
+			membJobMap[membID] = append([]string{}, jobIDs...)
+		}
+	}
+
+	aliveMembers := kernel.clusterManager.GetCluster().GetAliveMemberIDs()
+	assignments, err := kernel.organize(allJobs, aliveMembers, membJobMap)
+	placementErr, ok := err.(*job.PlacementError)
+	if err != nil && !ok {
+		return nil, err
+	}
+
+	plan = job.NewPlan(allJobs, current, assignments)
+	if placementErr != nil {
+		plan.Unplaced = placementErr.Jobs
+	}
+	return plan, nil
+}
+
+// ApplyPlan writes member jobs of plan. Only the leader applies plans. The plan fails with
+// job.ErrStalePlan if jobs or member jobs changed since it was made, and with job.ErrInvalidPlan
+// if it assigns jobs against active members, cordons or pins.
+func (kernel *Kernel) ApplyPlan(plan *job.Plan) (err error) {
+	if !kernel.clusterManager.IsLeader() {
+		return job.ErrNotLeader
+	}
+
+	allJobs, err := kernel.jobManager.GetAllJobs()
+	if err != nil {
+		return err
+	}
+	current, err := kernel.jobManager.GetAllMemberJobIDs()
+	if err != nil {
+		return err
+	}
+	aliveMembers := kernel.clusterManager.GetCluster().GetAliveMemberIDs()
+	err = plan.Check(allJobs, current, kernel.activeMembers(aliveMembers))
+	if err != nil {
+		return err
+	}
+
+	leaderKey, term := kernel.clusterManager.LeaderKey()
+	err = kernel.jobManager.SetAllMemberJobIDs(leaderKey, term, plan.Assignments, aliveMembers)
+	if err == nil {
+		log.Println("[INFO-Kernel] Rebalance plan applied. moves:", len(plan.Moves))
+	}
+	return err
+}
+
+// Rebalance plans and applies at once
+func (kernel *Kernel) Rebalance(full bool) (plan *job.Plan, err error) {
+	plan, err = kernel.PlanRebalance(full)
+	if err != nil {
+		return nil, err
+	}
+	return plan, kernel.ApplyPlan(plan)
+}
@@ -0,0 +1,114 @@
+package kernel
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+// State connection state of kernel to KV store
+type State int
+
+const (
+	// StateConnected KV store is reachable
+	StateConnected State = iota
+	// StateDisconnected KV store is unreachable. Workers are paused until it is reachable again.
+	StateDisconnected
+)
+
+func (state State) String() string {
+	if state == StateDisconnected {
+		return "disconnected"
+	}
+	return "connected"
+}
+
+// Status ..
+type Status struct {
+	ID       string    `json:"id"`
+	Cluster  string    `json:"cluster"`
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Since    time.Time `json:"since"`
+	Leader   bool      `json:"leader"`
+	Draining bool      `json:"draining"`
+	Paused   bool      `json:"paused"`
+	Workers  []string  `json:"workers"`
+}
+
+// State returns connection state and the time it changed
+func (kernel *Kernel) State() (state State, since time.Time) {
+	kernel.stateMutex.RLock()
+	defer kernel.stateMutex.RUnlock()
+	return kernel.state, kernel.stateSince
+}
+
+// Status ..
+func (kernel *Kernel) Status() Status {
+	state, since := kernel.State()
+	status := Status{ID: kernel.id, Cluster: kernel.config.Cluster, Name: kernel.config.Name,
+		State: state.String(), Since: since, Workers: []string{}}
+
+	if clusterManager := kernel.GetClusterManager(); clusterManager != nil {
+		status.Leader = clusterManager.IsLeader()
+		status.Draining = clusterManager.IsDraining()
+	}
+	if kernel.workerManager != nil {
+		status.Paused = kernel.workerManager.IsPaused()
+		status.Workers = kernel.workerManager.GetWorkerIDs()
+	}
+	return status
+}
+
+func (kernel *Kernel) setState(state State) {
+	kernel.stateMutex.Lock()
+	if kernel.state == state {
+		kernel.stateMutex.Unlock()
+		return
+	}
+	kernel.state = state
+	kernel.stateSince = time.Now()
+	kernel.stateMutex.Unlock()
+
+	log.Println("[WARN-Kernel] KV Store", state)
+
+	if state == StateDisconnected {
+		kernel.workerManager.Pause()
+	} else {
+		kernel.workerManager.Resume()
+	}
+}
+
+// checkConnection pings KV store while kernel is running. When it is unreachable,
+// kernel is disconnected and retries with backoff until it is reachable again.
+func (kernel *Kernel) checkConnection() {
+	store := kernel.kv
+	backoff := reconnectMinBackoff
+
+	for {
+		err := store.Ping()
+		if err == nil {
+			backoff = reconnectMinBackoff
+			kernel.setState(StateConnected)
+			if !kernel.sleep(time.Duration(kernel.config.CheckHeartbeatInterval)) {
+				return
+			}
+			continue
+		}
+
+		log.Println("[ERROR-Kernel] KV Store is unreachable. Retry after", backoff, err)
+		kernel.setState(StateDisconnected)
+		if !kernel.sleep(backoff) {
+			return
+		}
+
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
@@ -39,9 +39,58 @@ const (
 
 // NewWorker implements worker.Factory.NewWorker
 func (abstractFactory *AbstractWorkerFactory) NewWorker(helper *Helper) (wroker Worker, err error) {
-	jobData := helper.Job()
+	factory, data, err := abstractFactory.parseJob(helper.Job())
+	if err != nil {
+		return nil, err
+	}
+	helper.job = data
+	return factory.NewWorker(helper)
+}
+
+// Weight implements worker.Weigher. Jobs of factories which are not Weigher weigh 1.
+func (abstractFactory *AbstractWorkerFactory) Weight(job []byte) (weight int, err error) {
+	factory, data, err := abstractFactory.parseJob(job)
+	if err != nil {
+		return 1, err
+	}
+	if weigher, ok := factory.(Weigher); ok {
+		return weigher.Weight(data)
+	}
+	return 1, nil
+}
+
+// Validate implements worker.Validator. Job data must name a registered factory, and is validated
+// by the factory if it is a Validator.
+func (abstractFactory *AbstractWorkerFactory) Validate(job []byte) error {
+	factory, data, err := abstractFactory.parseJob(job)
+	if err != nil {
+		return &ValidationError{Factory: abstractFactory.name, Field: "factory", Message: err.Error()}
+	}
+	validator, ok := factory.(Validator)
+	if !ok {
+		return nil
+	}
+	return toValidationError(factory.Name(), validator.Validate(data))
+}
+
+// toValidationError fills factory name of err, or wraps err which is not *ValidationError
+func toValidationError(factoryName string, err error) error {
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		return &ValidationError{Factory: factoryName, Message: err.Error()}
+	}
+	if validationErr.Factory == "" {
+		validationErr.Factory = factoryName
+	}
+	return validationErr
+}
 
-	if jobData[0] == sharp {
+// parseJob returns the factory named in job data and the data for the factory
+func (abstractFactory *AbstractWorkerFactory) parseJob(jobData []byte) (factory Factory, data []byte, err error) {
+	if len(jobData) > 0 && jobData[0] == sharp {
 		index := -1
 		for i, b := range jobData {
 			index = i
@@ -51,17 +100,16 @@ func (abstractFactory *AbstractWorkerFactory) NewWorker(helper *Helper) (wroker
 		}
 		if index < 2 {
 			err = errors.New("Job Data must be started with '#factory-name:'")
-			return nil, err
+			return nil, nil, err
 		}
 		factoryName := string(jobData[1:index])
 
 		factory, err := abstractFactory.GetFactory(factoryName)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		helper.job = jobData[index+1:]
-		return factory.NewWorker(helper)
+		return factory, jobData[index+1:], nil
 	}
 	err = errors.New("Job Data must be started with '#factory-name:'")
-	return nil, err
+	return nil, nil, err
 }
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+)
+
+// validatingFactory accepts only job data "ok"
+type validatingFactory struct {
+	name string
+}
+
+func (factory *validatingFactory) Name() string                             { return factory.name }
+func (factory *validatingFactory) NewWorker(helper *Helper) (Worker, error) { return nil, nil }
+func (factory *validatingFactory) Validate(job []byte) error {
+	if string(job) != "ok" {
+		return errors.New("not ok")
+	}
+	return nil
+}
+
+// plainFactory is not a Validator
+type plainFactory struct{}
+
+func (factory *plainFactory) Name() string                             { return "plain" }
+func (factory *plainFactory) NewWorker(helper *Helper) (Worker, error) { return nil, nil }
+
+func TestAbstractFactoryValidate(t *testing.T) {
+	root := NewAbstractWorkerFactory("root")
+	root.AddFactory(&validatingFactory{name: "v"})
+	root.AddFactory(&plainFactory{})
+
+	if err := root.Validate([]byte("#v:ok")); err != nil {
+		t.Fatal("valid job is rejected", err)
+	}
+	if err := root.Validate([]byte("#plain:anything")); err != nil {
+		t.Fatal("job of factory which is not a Validator is rejected", err)
+	}
+
+	for _, data := range []string{"ok", "#none:ok", "#:ok"} {
+		validationErr, ok := root.Validate([]byte(data)).(*ValidationError)
+		if !ok || validationErr.Factory != "root" || validationErr.Field != "factory" {
+			t.Fatal("job without a registered factory must be rejected", data, validationErr)
+		}
+	}
+
+	validationErr, ok := root.Validate([]byte("#v:bad")).(*ValidationError)
+	if !ok || validationErr.Factory != "v" || validationErr.Message != "not ok" {
+		t.Fatal("error of the factory must be wrapped with its name", validationErr)
+	}
+}
+
+func TestMultiFactoryValidate(t *testing.T) {
+	multi, err := NewMultiWorkerFactory("multi", []Factory{&plainFactory{}, &validatingFactory{name: "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = multi.Validate([]byte("ok")); err != nil {
+		t.Fatal("valid job is rejected", err)
+	}
+	validationErr, ok := multi.Validate([]byte("bad")).(*ValidationError)
+	if !ok || validationErr.Factory != "v" {
+		t.Fatal("job must be valid for all sub factories", validationErr)
+	}
+
+	// routed by the root factory
+	root := NewAbstractWorkerFactory("root")
+	root.AddFactory(multi)
+	if validationErr, ok = root.Validate([]byte("#multi:bad")).(*ValidationError); !ok || validationErr.Factory != "v" {
+		t.Fatal("sub factory error must reach the root factory", validationErr)
+	}
+}
@@ -1,6 +1,9 @@
 package worker
 
-import "log"
+import (
+	"log"
+	"sort"
+)
 
 // MultiWorkerFactory implements worker.Factory.
 // This factory has many sub factories and create MultiWorker that has sub-workers
@@ -41,6 +44,42 @@ func (factory *MultiWorkerFactory) NewWorker(helper *Helper) (wroker Worker, err
 	return multiWorker, nil
 }
 
+// Weight implements worker.Weigher. A job weighs the sum of its sub workers.
+func (factory *MultiWorkerFactory) Weight(job []byte) (weight int, err error) {
+	for _, fac := range factory.workerFactories {
+		subWeight := 1
+		if weigher, ok := fac.(Weigher); ok {
+			subWeight, err = weigher.Weight(job)
+			if err != nil {
+				return 1, err
+			}
+		}
+		weight += subWeight
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	return weight, nil
+}
+
+// Validate implements worker.Validator. A job must be valid for all sub factories.
+func (factory *MultiWorkerFactory) Validate(job []byte) error {
+	names := []string{}
+	for name := range factory.workerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if validator, ok := factory.workerFactories[name].(Validator); ok {
+			if err := validator.Validate(job); err != nil {
+				return toValidationError(name, err)
+			}
+		}
+	}
+	return nil
+}
+
 // MultiWorker imeplements Worker, which has many sub workers
 type MultiWorker struct {
 	id      string
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"time"
+)
+
+// states of jobs
+const (
+	// JobPending the job is assigned to no member
+	JobPending = "pending"
+	// JobAssigned the job is assigned to a member, but its worker is not started yet
+	JobAssigned = "assigned"
+	// JobRunning the worker of the job is running
+	JobRunning = "running"
+	// JobPaused the worker of the job is stopped by Pause
+	JobPaused = "paused"
+	// JobFailed the worker of the job cannot be created or started. It is retried on next SetJobs.
+	JobFailed = "failed"
+	// JobStopped the worker of the job is released by its owner, as the job moved away, is paused or removed
+	JobStopped = "stopped"
+)
+
+// JobStatus : status of a job written by the member owning it
+type JobStatus struct {
+	State        string    `json:"state"`
+	Error        string    `json:"error,omitempty"`
+	Owner        string    `json:"owner,omitempty"`
+	StartedAt    time.Time `json:"startedAt,omitempty"`
+	RestartCount int       `json:"restartCount"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// localStatus : status of a job set to local member, kept after the job is released to keep its counters
+type localStatus struct {
+	JobStatus
+	// token fencing token of the job when the status changed
+	token int64
+	// revision mod revision of the status last written by local member
+	revision int64
+	// dirty status is changed but not written yet
+	dirty bool
+}
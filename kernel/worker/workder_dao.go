@@ -1,6 +1,8 @@
 package worker 
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 
@@ -10,20 +12,94 @@ import (
 const (
 	kvDirSys            = "/$sys/"
 	kvDirClusters       = kvDirSys + "clstrs/"
-	kvPatternCheckpoint = kvDirClusters + "%s/checkpoint/%s"
-	kvPatternDataJobID  = kvDirClusters + "%s/data/%s/"
+	kvPatternClusterDir = kvDirClusters + "%s/"
+	kvPatternCheckpoint = "checkpoint/%s"
+	kvPatternDataJobID  = "data/%s/"
 	kvPatternData       = kvPatternDataJobID + "%s"
+	kvPatternFence      = "fence/%s"
+	kvDirStatus         = "status/"
+	kvPatternStatus     = kvDirStatus + "%s"
 )
 
+// ErrStaleToken returned when a write is fenced by a token of a member which does not own the job any more
+var ErrStaleToken = errors.New("Fencing token is stale. The job is owned by another member")
+
+// ErrNotFenced returned when a write has no fencing token, because the job is not fenced to local member yet
+var ErrNotFenced = errors.New("Job is not fenced to local member")
+
+// fence : owner of a job written by the leader
+type fence struct {
+	Member string `json:"member"`
+	Term   int64  `json:"term"`
+}
+
 // DAO kv store model for cluster
 type DAO struct {
 	cluster string
-	kv      kv.KV
+	// kv view of the cluster directory
+	kv kv.KV
+}
+
+// newDAO ..
+func newDAO(cluster string, store kv.KV) *DAO {
+	return &DAO{cluster: cluster, kv: kv.NewNamespace(store, fmt.Sprintf(kvPatternClusterDir, cluster))}
+}
+
+// jobKV returns a view confined to the data directory of the job
+func (dao *DAO) jobKV(jobid string) kv.KV {
+	return kv.NewConfinedNamespace(dao.kv, fmt.Sprintf(kvPatternDataJobID, jobid))
+}
+
+// GetFencingToken returns the token of memberID for jobid, the revision its fence was written at.
+// Token is 0 when jobid has no fence, and ErrStaleToken is returned when it is fenced to another member.
+func (dao *DAO) GetFencingToken(jobid string, memberID string) (token int64, err error) {
+	key := fmt.Sprintf(kvPatternFence, jobid)
+	value, token, err := dao.kv.GetOneWithRevision(key)
+	if errors.Is(err, kv.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	owner := fence{}
+	err = json.Unmarshal(value, &owner)
+	if err != nil {
+		return 0, err
+	}
+	if owner.Member != memberID {
+		return 0, ErrStaleToken
+	}
+	return token, nil
+}
+
+// txn runs ops, fenced by token of fenceID.
+// Token 0 means the job had no fence when the token was read, and such writes fail with ErrNotFenced.
+func (dao *DAO) txn(fenceID string, token int64, ops ...kv.Op) error {
+	_, err := dao.txnWithRevision(fenceID, token, ops...)
+	return err
+}
+
+// txnWithRevision runs ops as txn, and returns revision of the writes
+func (dao *DAO) txnWithRevision(fenceID string, token int64, ops ...kv.Op) (revision int64, err error) {
+	if token == 0 {
+		return 0, ErrNotFenced
+	}
+	compares := []kv.Compare{kv.ModRevisionEquals(fmt.Sprintf(kvPatternFence, fenceID), token)}
+
+	succeeded, revision, err := dao.kv.Txn(compares, ops)
+	if err == nil && !succeeded {
+		err = ErrStaleToken
+	}
+	return revision, err
 }
 
 // PutCheckpoint ..
-func (dao *DAO) PutCheckpoint(jobid string, checkpoint interface{}) error {
-	_, err := dao.kv.PutObject(fmt.Sprintf(kvPatternCheckpoint, dao.cluster, jobid), checkpoint)
+func (dao *DAO) PutCheckpoint(fenceID string, token int64, jobid string, checkpoint interface{}) error {
+	op, err := kv.OpPutObject(fmt.Sprintf(kvPatternCheckpoint, jobid), checkpoint)
+	if err == nil {
+		err = dao.txn(fenceID, token, op)
+	}
 	if err != nil {
 		log.Println("[ERROR-WorkerDao] PutCheckpoint", err)
 	}
@@ -32,16 +108,39 @@ func (dao *DAO) PutCheckpoint(jobid string, checkpoint interface{}) error {
 
 // GetCheckpoint ..
 func (dao *DAO) GetCheckpoint(jobid string, checkpoint interface{}) error {
-	err := dao.kv.GetObject(fmt.Sprintf(kvPatternCheckpoint, dao.cluster, jobid), checkpoint)
+	err := dao.kv.GetObject(fmt.Sprintf(kvPatternCheckpoint, jobid), checkpoint)
 	if err != nil {
 		log.Println("[ERROR-WorkerDao] GetCheckpoint ", err)
 	}
 	return err
 }
 
+// PutCheckpointWithData writes checkpoint and data row atomically
+func (dao *DAO) PutCheckpointWithData(fenceID string, token int64, jobid string, checkpoint interface{}, rowID string, data interface{}) error {
+	checkpointOp, err := kv.OpPutObject(fmt.Sprintf(kvPatternCheckpoint, jobid), checkpoint)
+	if err != nil {
+		log.Println("[ERROR-WorkerDao] PutCheckpointWithData", err)
+		return err
+	}
+	dataOp, err := kv.OpPutObject(fmt.Sprintf(kvPatternData, jobid, rowID), data)
+	if err != nil {
+		log.Println("[ERROR-WorkerDao] PutCheckpointWithData", err)
+		return err
+	}
+
+	err = dao.txn(fenceID, token, checkpointOp, dataOp)
+	if err != nil {
+		log.Println("[ERROR-WorkerDao] PutCheckpointWithData", err)
+	}
+	return err
+}
+
 // PutData ..
-func (dao *DAO) PutData(jobid string, rowID string, data interface{}) error {
-	_, err := dao.kv.PutObject(fmt.Sprintf(kvPatternData, dao.cluster, jobid, rowID), data)
+func (dao *DAO) PutData(fenceID string, token int64, jobid string, rowID string, data interface{}) error {
+	op, err := kv.OpPutObject(fmt.Sprintf(kvPatternData, jobid, rowID), data)
+	if err == nil {
+		err = dao.txn(fenceID, token, op)
+	}
 	if err != nil {
 		log.Println("[ERROR-WorkerDao] PutData", err)
 	}
@@ -50,7 +149,7 @@ func (dao *DAO) PutData(jobid string, rowID string, data interface{}) error {
 
 // GetData ..
 func (dao *DAO) GetData(jobid string, rowID string, data interface{}) error {
-	err := dao.kv.GetObject(fmt.Sprintf(kvPatternData, dao.cluster, jobid, rowID), data)
+	err := dao.kv.GetObject(fmt.Sprintf(kvPatternData, jobid, rowID), data)
 	if err != nil {
 		log.Println("[ERROR-WorkerDao] GetData ", err)
 	}
@@ -58,19 +157,67 @@ func (dao *DAO) GetData(jobid string, rowID string, data interface{}) error {
 }
 
 // DeleteData ..
-func (dao *DAO) DeleteData(jobid string, rowID string) error {
-	_, err := dao.kv.DeleteOne(fmt.Sprintf(kvPatternData, dao.cluster, jobid, rowID))
+func (dao *DAO) DeleteData(fenceID string, token int64, jobid string, rowID string) error {
+	err := dao.txn(fenceID, token, kv.OpDelete(fmt.Sprintf(kvPatternData, jobid, rowID)))
 	if err != nil {
-		log.Println("[ERROR-WorkerDao] GetData ", err)
+		log.Println("[ERROR-WorkerDao] DeleteData ", err)
 	}
 	return err
 }
 
 // GetDataWithJobID ..
 func (dao *DAO) GetDataWithJobID(jobid string, handler func(key string, value []byte)) error {
-	err := dao.kv.GetWithPrefix(fmt.Sprintf(kvPatternDataJobID, dao.cluster, jobid), handler)
+	err := dao.kv.GetWithPrefix(fmt.Sprintf(kvPatternDataJobID, jobid), handler)
 	if err != nil {
 		log.Println("[ERROR-WorkerDao] GetDataWithJobID ", err)
 	}
 	return err
 }
+
+// PutStatus writes status of jobid, fenced by token of jobid. Returns mod revision of the status.
+func (dao *DAO) PutStatus(token int64, jobid string, status JobStatus) (revision int64, err error) {
+	op, err := kv.OpPutObject(fmt.Sprintf(kvPatternStatus, jobid), status)
+	if err == nil {
+		revision, err = dao.txnWithRevision(jobid, token, op)
+	}
+	if err != nil {
+		log.Println("[ERROR-WorkerDao] PutStatus", jobid, err)
+	}
+	return revision, err
+}
+
+// PutReleasedStatus writes status of a job released by local member, only while the status is
+// still at revision written by local member. The fence of a released job belongs to its new owner,
+// or is deleted, and the new owner may have written its status already.
+func (dao *DAO) PutReleasedStatus(revision int64, jobid string, status JobStatus) error {
+	key := fmt.Sprintf(kvPatternStatus, jobid)
+	op, err := kv.OpPutObject(key, status)
+	if err != nil {
+		return err
+	}
+	succeeded, _, err := dao.kv.Txn([]kv.Compare{kv.ModRevisionEquals(key, revision)}, []kv.Op{op})
+	if err == nil && !succeeded {
+		err = ErrStaleToken
+	}
+	if err != nil && err != ErrStaleToken {
+		log.Println("[ERROR-WorkerDao] PutReleasedStatus", jobid, err)
+	}
+	return err
+}
+
+// GetStatuses returns statuses of all jobs
+func (dao *DAO) GetStatuses() (statuses map[string]JobStatus, err error) {
+	statuses = make(map[string]JobStatus)
+	err = dao.kv.GetWithPrefix(kvDirStatus, func(key string, value []byte) {
+		status := JobStatus{}
+		if err2 := json.Unmarshal(value, &status); err2 != nil {
+			log.Println("[ERROR-WorkerDao] Cannot parse status ", key, err2)
+			return
+		}
+		statuses[key[len(kvDirStatus):]] = status
+	})
+	if err != nil {
+		log.Println("[ERROR-WorkerDao] GetStatuses ", err)
+	}
+	return statuses, err
+}
@@ -1,6 +1,8 @@
 package worker
 
 import (
+	"sync/atomic"
+
 	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
 )
 
@@ -12,6 +14,45 @@ type Worker interface {
 	IsStarted() bool
 }
 
+// Flusher is implemented by workers buffering checkpoints. Flush is called before the worker is stopped
+// to hand its job over to another member.
+type Flusher interface {
+	Flush() error
+}
+
+// Weigher is implemented by factories whose workers cost differently. Weight of a job is
+// the relative cost of its worker, 1 for a plain worker.
+type Weigher interface {
+	Weight(job []byte) (weight int, err error)
+}
+
+// Validator is implemented by factories which check job data before the job is stored.
+// Validate returns *ValidationError for invalid data.
+type Validator interface {
+	Validate(job []byte) error
+}
+
+// ValidationError : invalid job data, with the factory and the field which rejected it
+type ValidationError struct {
+	Factory string
+	// Field field of job data, empty when the whole data is invalid
+	Field   string
+	Message string
+}
+
+func (err *ValidationError) Error() string {
+	if err.Field == "" {
+		return "Invalid job for " + err.Factory + ": " + err.Message
+	}
+	return "Invalid job for " + err.Factory + ", " + err.Field + ": " + err.Message
+}
+
+// JobSpec : data of a job and its spec version. Workers are restarted when the version changes.
+type JobSpec struct {
+	Data    []byte
+	Version int64
+}
+
 // Factory ..
 type Factory interface {
 	Name() string
@@ -26,19 +67,29 @@ type Helper struct {
 	kv      kv.KV
 	dao     *DAO
 	started bool
+	// fenceID job id whose fence guards writes. Child helpers share it with the parent.
+	fenceID string
+	token   *int64
+	// member local member id, to read the token again when the job had no fence
+	member string
+	// version spec version of the job
+	version int64
 }
 
 // NewHelper ..
 func NewHelper(cluster string, id string, job []byte, kv kv.KV) *Helper {
-	helper := Helper{cluster: cluster, id: id, job: job, kv: kv}
-	helper.dao = &DAO{cluster: cluster, kv: kv}
+	helper := Helper{cluster: cluster, id: id, job: job, fenceID: id, token: new(int64)}
+	helper.dao = newDAO(cluster, kv)
+	helper.kv = helper.dao.jobKV(id)
 	return &helper
 }
 
 // CreateChildHelper ...
 func (helper *Helper) CreateChildHelper(subid string, job []byte) *Helper {
-	helper2 := Helper{cluster: helper.cluster, id: helper.id + "-" + subid, job: job, kv: helper.kv}
+	helper2 := Helper{cluster: helper.cluster, id: helper.id + "-" + subid, job: job,
+		fenceID: helper.fenceID, token: helper.token, member: helper.member}
 	helper2.dao = helper.dao
+	helper2.kv = helper.dao.jobKV(helper2.id)
 	return &helper2
 }
 
@@ -47,6 +98,11 @@ func (helper *Helper) ID() string {
 	return helper.id
 }
 
+// Version get spec version of worker's Job
+func (helper *Helper) Version() int64 {
+	return helper.version
+}
+
 // Job get worker's Job
 func (helper *Helper) Job() []byte {
 	return helper.job
@@ -57,14 +113,44 @@ func (helper *Helper) IsStarted() bool {
 	return helper.started
 }
 
-// KV get worker's KV
+// KV get worker's KV, confined to the data directory of the job.
+// Keys are relative to the directory, same as rowID of PutData: key "a" is stored as
+// /$sys/clstrs/<cluster>/data/<jobid>/a. Earlier versions returned the whole store with absolute keys,
+// and workers reading keys outside the directory must use their own KV.
+// Compaction, elections and leases not granted through this KV fail with kv.ErrConfined.
+// Writes through this KV are not fenced, and may be made by a member the job moved away from.
+// Use it to read, and write with PutCheckpoint, PutCheckpointWithData, PutData and DeleteData.
 func (helper *Helper) KV() kv.KV {
 	return helper.kv
 }
 
+// FencingToken get token of the job assignment to local member. Checkpoint and data writes
+// fail with ErrStaleToken once the job is assigned to another member. 0 means the job had no fence,
+// as jobs assigned by leaders of older versions, and writes read the token again or fail with ErrNotFenced.
+func (helper *Helper) FencingToken() int64 {
+	return atomic.LoadInt64(helper.token)
+}
+
+// writeToken returns the token for a write, read again if the job had no fence
+func (helper *Helper) writeToken() int64 {
+	token := helper.FencingToken()
+	if token == 0 && helper.member != "" {
+		fenced, err := helper.dao.GetFencingToken(helper.fenceID, helper.member)
+		if err == nil && fenced != 0 {
+			helper.setFencingToken(fenced)
+			token = fenced
+		}
+	}
+	return token
+}
+
+func (helper *Helper) setFencingToken(token int64) {
+	atomic.StoreInt64(helper.token, token)
+}
+
 // PutCheckpoint ..
 func (helper *Helper) PutCheckpoint(checkpoint interface{}) error {
-	return helper.dao.PutCheckpoint(helper.id, checkpoint)
+	return helper.dao.PutCheckpoint(helper.fenceID, helper.writeToken(), helper.id, checkpoint)
 }
 
 // GetCheckpoint ..
@@ -72,9 +158,14 @@ func (helper *Helper) GetCheckpoint(checkpoint interface{}) error {
 	return helper.dao.GetCheckpoint(helper.id, checkpoint)
 }
 
+// PutCheckpointWithData writes checkpoint and data row atomically
+func (helper *Helper) PutCheckpointWithData(checkpoint interface{}, rowID string, data interface{}) error {
+	return helper.dao.PutCheckpointWithData(helper.fenceID, helper.writeToken(), helper.id, checkpoint, rowID, data)
+}
+
 // PutData ..
 func (helper *Helper) PutData(rowID string, data interface{}) error {
-	return helper.dao.PutData(helper.id, rowID, data)
+	return helper.dao.PutData(helper.fenceID, helper.writeToken(), helper.id, rowID, data)
 }
 
 // GetData ..
@@ -84,5 +175,5 @@ func (helper *Helper) GetData(rowID string, data interface{}) error {
 
 // DeleteData ..
 func (helper *Helper) DeleteData(rowID string) error {
-	return helper.dao.DeleteData(helper.id, rowID)
+	return helper.dao.DeleteData(helper.fenceID, helper.writeToken(), helper.id, rowID)
 }
@@ -3,18 +3,29 @@ package worker
 import (
 	"errors"
 	"log"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
 )
 
 // Manager ..
 type Manager struct {
+	mutex   sync.Mutex
 	cluster string
 	localid string
 	kv      kv.KV
 	// workerFactoryMethod func(helper *Helper) (Worker, error)
 	workerFactory Factory
 	workers       map[string]Worker
+	helpers       map[string]*Helper
+	dao           *DAO
+	// paused workers are stopped but kept until Resume
+	paused bool
+	// statuses of jobs set to local member. Statuses are written while not paused, and kept after
+	// jobs are released so that counters persist when jobs come back.
+	statuses map[string]*localStatus
 }
 
 // NewManager create Manager
@@ -23,6 +34,9 @@ func NewManager(cluster string, localid string, kv kv.KV,
 	manager := Manager{cluster: cluster, localid: localid, kv: kv,
 		workerFactory: workerFactory}
 	manager.workers = make(map[string]Worker)
+	manager.helpers = make(map[string]*Helper)
+	manager.statuses = make(map[string]*localStatus)
+	manager.dao = newDAO(cluster, kv)
 	return &manager
 }
 
@@ -40,7 +54,11 @@ func (manager *Manager) registerWorker(id string, job []byte) error {
 	if manager.workers[id] != nil {
 		return errors.New("Worker[" + id + "] is already registered. If you want register new one, DeregisterWorker first")
 	}
-	helper := NewHelper(manager.cluster, id, job, manager.kv)
+	helper, err := manager.newHelper(id, JobSpec{Data: job})
+	if err != nil {
+		log.Println("[ERROR] Cannot create worker helper ", err)
+		return err
+	}
 	worker, err := manager.workerFactory.NewWorker(helper)
 	if err != nil {
 		log.Println("[ERROR] Cannot create worker ", err)
@@ -48,6 +66,10 @@ func (manager *Manager) registerWorker(id string, job []byte) error {
 	}
 
 	manager.workers[id] = worker
+	manager.helpers[id] = helper
+	if manager.paused {
+		return nil
+	}
 	err = worker.Start()
 	return err
 }
@@ -63,6 +85,7 @@ func (manager *Manager) deregisterWorker(id string) error {
 
 	if err == nil {
 		delete(manager.workers, id)
+		delete(manager.helpers, id)
 	}
 
 	return err
@@ -70,6 +93,9 @@ func (manager *Manager) deregisterWorker(id string) error {
 
 // Dispose ..
 func (manager *Manager) Dispose() error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
 	array := []string{}
 	for id := range manager.workers {
 		array = append(array, id)
@@ -82,50 +108,311 @@ func (manager *Manager) Dispose() error {
 	return nil
 }
 
-// SetJobs ..
-func (manager *Manager) SetJobs(jobs map[string][]byte) {
+// SetJobs runs workers of jobs and stops workers of other jobs.
+// Workers whose job version changed are restarted with the new spec, keeping checkpoint and data of the job.
+func (manager *Manager) SetJobs(jobs map[string]JobSpec) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
 	log.Println("[WARN-WorkerManager] Set Jobs:", len(jobs))
 
 	tempWorkers := make(map[string]Worker)
 	newWorkers := make(map[string]Worker)
+	newHelpers := make(map[string]*Helper)
 
 	for id, worker := range manager.workers {
 		tempWorkers[id] = worker
 	}
 
-	for id, data := range jobs {
+	for id, spec := range jobs {
 		worker := tempWorkers[id]
+		helper := manager.helpers[id]
+		if worker != nil && helper != nil && helper.version != spec.Version {
+			delete(tempWorkers, id)
+			manager.stopWorker(id, worker)
+			log.Println("[WARN-WorkerMan] Restart Worker with version", spec.Version, ".....", id)
+			worker = nil
+		}
 		if worker != nil {
 			delete(tempWorkers, id)
+			manager.refreshFencingToken(helper)
 		} else {
-			helper := NewHelper(manager.cluster, id, data, manager.kv)
+			var err error
+			helper, err = manager.newHelper(id, spec)
+			if err != nil {
+				log.Println("[ERROR-WorkerMan] Cannot create worker helper ", id, err)
+				continue
+			}
 			// worker = manager.workerFactoryMethod(helper)
 			worker2, err := manager.workerFactory.NewWorker(helper)
 			if err != nil {
-				log.Println("[ERROR-WorkerMan] Cannot create worker ", err)
+				log.Println("[ERROR-WorkerMan] Cannot create worker ", id, err)
+				manager.setStatus(helper, JobFailed, err)
 				continue
 			} else {
 				worker = worker2
+				manager.setStatus(helper, JobAssigned, nil)
 				log.Println("[WARN-WorkerMan] New Worker .....", id)
 			}
 		}
 
 		newWorkers[id] = worker
+		newHelpers[id] = helper
 	}
 	// 제거된 worker 종료하기
 	for id, worker := range tempWorkers {
-		worker.Stop()
+		manager.stopWorker(id, worker)
 		log.Println("[WARN-WorkerMan] Dispose Worker .....", id)
 	}
 
 	manager.workers = newWorkers
+	manager.helpers = newHelpers
+	for id, status := range manager.statuses {
+		if _, ok := jobs[id]; !ok && status.State != JobStopped {
+			manager.releaseStatus(id)
+		}
+	}
+
+	if manager.paused {
+		for id, worker := range manager.workers {
+			if !worker.IsStarted() {
+				manager.setStatus(manager.helpers[id], JobPaused, nil)
+			}
+		}
+		log.Println("[WARN-WorkerMan] Workers are paused. Start on Resume.")
+		return
+	}
 
 	for id, worker := range manager.workers {
 		if !worker.IsStarted() {
-			worker.Start()
+			manager.startWorker(id, worker)
 			log.Println("[WARN-WorkerMan] New Worker Started .....", id)
 		} else {
 			log.Println("[WARN-WorkerMan] Remained Worker .....", id)
 		}
 	}
+	manager.flushStatuses()
+}
+
+// stopWorker flushes and stops the worker
+func (manager *Manager) stopWorker(id string, worker Worker) {
+	if flusher, ok := worker.(Flusher); ok && worker.IsStarted() {
+		if err := flusher.Flush(); err != nil {
+			log.Println("[ERROR-WorkerMan] Cannot flush worker ", id, err)
+		}
+	}
+	worker.Stop()
+}
+
+// startWorker starts the worker and records its status. A worker failed to start is dropped
+// to be created again on next SetJobs.
+func (manager *Manager) startWorker(id string, worker Worker) {
+	helper := manager.helpers[id]
+	err := worker.Start()
+	if err != nil {
+		log.Println("[ERROR-WorkerMan] Cannot start worker ", id, err)
+		manager.setStatus(helper, JobFailed, err)
+		delete(manager.workers, id)
+		delete(manager.helpers, id)
+		return
+	}
+	manager.setStatus(helper, JobRunning, nil)
+}
+
+// setStatus records state of the job, and writes it fenced by the token of helper unless workers are paused.
+// Error is kept as the last error until another error occurs.
+func (manager *Manager) setStatus(helper *Helper, state string, cause error) {
+	status := manager.statuses[helper.id]
+	if status == nil {
+		status = &localStatus{JobStatus: JobStatus{Owner: manager.localid}}
+		manager.statuses[helper.id] = status
+	}
+
+	now := time.Now()
+	if state == JobRunning {
+		if !status.StartedAt.IsZero() {
+			status.RestartCount++
+		}
+		status.StartedAt = now
+	}
+	if cause != nil {
+		status.Error = cause.Error()
+	}
+	status.State = state
+	status.UpdatedAt = now
+	status.token = helper.FencingToken()
+	status.dirty = true
+
+	if !manager.paused {
+		manager.flushStatus(helper.id, status)
+	}
+}
+
+// releaseStatus records that local member released the job
+func (manager *Manager) releaseStatus(id string) {
+	status := manager.statuses[id]
+	status.State = JobStopped
+	status.UpdatedAt = time.Now()
+	status.dirty = true
+
+	if !manager.paused {
+		manager.flushStatus(id, status)
+	}
+}
+
+// flushStatus writes the status if it is changed. Statuses of released jobs are written unless
+// the new owner wrote its status. Statuses overwritten by other members are not written again.
+func (manager *Manager) flushStatus(id string, status *localStatus) {
+	if !status.dirty {
+		return
+	}
+
+	var err error
+	if status.State == JobStopped {
+		err = manager.dao.PutReleasedStatus(status.revision, id, status.JobStatus)
+	} else {
+		if status.token == 0 {
+			// the job had no fence when its status changed
+			status.token, _ = manager.dao.GetFencingToken(id, manager.localid)
+		}
+		var revision int64
+		revision, err = manager.dao.PutStatus(status.token, id, status.JobStatus)
+		if err == nil {
+			status.revision = revision
+		}
+	}
+	if err == nil || err == ErrStaleToken {
+		status.dirty = false
+	}
+}
+
+// flushStatuses writes statuses changed while workers were paused or failed to be written
+func (manager *Manager) flushStatuses() {
+	for id, status := range manager.statuses {
+		manager.flushStatus(id, status)
+	}
+}
+
+// GetJobStatuses returns statuses of all jobs written by their owners
+func (manager *Manager) GetJobStatuses() (map[string]JobStatus, error) {
+	return manager.dao.GetStatuses()
+}
+
+// newHelper creates a helper holding the fencing token of local member for the job
+func (manager *Manager) newHelper(id string, spec JobSpec) (*Helper, error) {
+	helper := NewHelper(manager.cluster, id, spec.Data, manager.kv)
+	helper.version = spec.Version
+	helper.member = manager.localid
+	token, err := manager.dao.GetFencingToken(id, manager.localid)
+	if err != nil {
+		return nil, err
+	}
+	helper.setFencingToken(token)
+	return helper, nil
+}
+
+// refreshFencingToken : the job may be fenced again, if it moved away and back
+func (manager *Manager) refreshFencingToken(helper *Helper) {
+	if helper == nil {
+		return
+	}
+	token, err := manager.dao.GetFencingToken(helper.fenceID, manager.localid)
+	if err != nil {
+		log.Println("[ERROR-WorkerMan] Cannot refresh fencing token ", helper.fenceID, err)
+		return
+	}
+	helper.setFencingToken(token)
+}
+
+// Pause stops all workers but keeps them, to start again on Resume.
+// Statuses are kept in memory while paused, and written on Resume.
+func (manager *Manager) Pause() {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.paused {
+		return
+	}
+	manager.paused = true
+
+	for id, worker := range manager.workers {
+		if worker.IsStarted() {
+			err := worker.Stop()
+			if err != nil {
+				log.Println("[ERROR-WorkerMan] Cannot pause worker ", id, err)
+				continue
+			}
+			manager.setStatus(manager.helpers[id], JobPaused, nil)
+		}
+	}
+	log.Println("[WARN-WorkerMan] Workers paused :", len(manager.workers))
+}
+
+// Resume starts workers paused by Pause
+func (manager *Manager) Resume() {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if !manager.paused {
+		return
+	}
+	manager.paused = false
+
+	for id, worker := range manager.workers {
+		if !worker.IsStarted() {
+			manager.startWorker(id, worker)
+		}
+	}
+	manager.flushStatuses()
+	log.Println("[WARN-WorkerMan] Workers resumed :", len(manager.workers))
+}
+
+// IsPaused ..
+func (manager *Manager) IsPaused() bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	return manager.paused
+}
+
+// GetWorkerIDs returns sorted ids of workers
+func (manager *Manager) GetWorkerIDs() []string {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	ids := []string{}
+	for id := range manager.workers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// HasJob returns whether the job is set to local member, even if its worker failed
+func (manager *Manager) HasJob(id string) bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	status := manager.statuses[id]
+	return manager.workers[id] != nil || (status != nil && status.State != JobStopped)
+}
+
+// JobSpec returns spec of the worker of the job, false if local member runs no worker of the job
+func (manager *Manager) JobSpec(id string) (spec JobSpec, ok bool) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	helper := manager.helpers[id]
+	if helper == nil {
+		return spec, false
+	}
+	return JobSpec{Data: helper.job, Version: helper.version}, true
+}
+
+// ForgetJob drops the status of a removed job
+func (manager *Manager) ForgetJob(id string) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	delete(manager.statuses, id)
 }
@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/rhizomata/bridge-chain-etcd/kernel/kv"
+)
+
+type testWorker struct {
+	id      string
+	started bool
+}
+
+func (worker *testWorker) ID() string      { return worker.id }
+func (worker *testWorker) Start() error    { worker.started = true; return nil }
+func (worker *testWorker) Stop() error     { worker.started = false; return nil }
+func (worker *testWorker) IsStarted() bool { return worker.started }
+
+type testFactory struct{}
+
+func (factory *testFactory) Name() string { return "test" }
+func (factory *testFactory) NewWorker(helper *Helper) (Worker, error) {
+	return &testWorker{id: helper.ID()}, nil
+}
+
+// fenceJob assigns job to member as the leader does, and returns the fencing token
+func fenceJob(t *testing.T, store kv.KV, jobID string, member string) int64 {
+	token, err := kv.NewNamespace(store, "/$sys/clstrs/c1/").Put("fence/"+jobID, `{"member":"`+member+`","term":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func writtenStatus(t *testing.T, manager *Manager, id string) JobStatus {
+	statuses, err := manager.GetJobStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return statuses[id]
+}
+
+func TestStatusWrittenOnResume(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager := NewManager("c1", "n1", store, &testFactory{})
+	fenceJob(t, store, "j1", "n1")
+
+	manager.SetJobs(map[string]JobSpec{"j1": {Data: []byte("a"), Version: 1}})
+	if status := writtenStatus(t, manager, "j1"); status.State != JobRunning || status.Owner != "n1" {
+		t.Fatal("running status is not written", status)
+	}
+
+	manager.Pause()
+	if status := writtenStatus(t, manager, "j1"); status.State != JobRunning {
+		t.Fatal("status must not be written while paused", status)
+	}
+
+	manager.Resume()
+	status := writtenStatus(t, manager, "j1")
+	if status.State != JobRunning || status.RestartCount != 1 {
+		t.Fatal("status is not written on resume", status)
+	}
+}
+
+func TestStatusKeptAfterRelease(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager := NewManager("c1", "n1", store, &testFactory{})
+	jobs := map[string]JobSpec{"j1": {Data: []byte("a"), Version: 1}}
+	fenceJob(t, store, "j1", "n1")
+
+	manager.SetJobs(jobs)
+	manager.SetJobs(map[string]JobSpec{})
+	status := writtenStatus(t, manager, "j1")
+	if status.State != JobStopped {
+		t.Fatal("stopped status is not written", status)
+	}
+	if manager.HasJob("j1") {
+		t.Fatal("released job is still set")
+	}
+
+	manager.SetJobs(jobs)
+	status = writtenStatus(t, manager, "j1")
+	if status.State != JobRunning || status.RestartCount != 1 {
+		t.Fatal("restart count is not kept", status)
+	}
+}
+
+func TestReleasedStatusKeepsNewOwner(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager := NewManager("c1", "n1", store, &testFactory{})
+	other := NewManager("c1", "n2", store, &testFactory{})
+	jobs := map[string]JobSpec{"j1": {Data: []byte("a"), Version: 1}}
+
+	fenceJob(t, store, "j1", "n1")
+	manager.SetJobs(jobs)
+	fenceJob(t, store, "j1", "n2")
+	other.SetJobs(jobs)
+	manager.SetJobs(map[string]JobSpec{})
+
+	status := writtenStatus(t, manager, "j1")
+	if status.State != JobRunning || status.Owner != "n2" {
+		t.Fatal("status of new owner is overwritten", status)
+	}
+}
+
+func TestJobSpecKeepsWorker(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager := NewManager("c1", "n1", store, &testFactory{})
+
+	if _, ok := manager.JobSpec("j1"); ok {
+		t.Fatal("job without worker has spec")
+	}
+	fenceJob(t, store, "j1", "n1")
+	manager.SetJobs(map[string]JobSpec{"j1": {Data: []byte("a"), Version: 2}})
+	spec, ok := manager.JobSpec("j1")
+	if !ok || string(spec.Data) != "a" || spec.Version != 2 {
+		t.Fatal("spec of worker is not returned", spec)
+	}
+
+	// setting the current spec again keeps the worker running
+	manager.SetJobs(map[string]JobSpec{"j1": spec})
+	status := writtenStatus(t, manager, "j1")
+	if status.State != JobRunning || status.RestartCount != 0 {
+		t.Fatal("worker is restarted with its current spec", status)
+	}
+}
+
+func TestStaleTokenRejected(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+
+	helper := NewHelper("c1", "j1", []byte("a"), store)
+	helper.setFencingToken(fenceJob(t, store, "j1", "n1"))
+	if err := helper.PutCheckpoint("cp1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the job moved to another member
+	fenceJob(t, store, "j1", "n2")
+	if err := helper.PutCheckpoint("cp2"); err != ErrStaleToken {
+		t.Fatal("write with stale token must fail", err)
+	}
+	if err := helper.PutData("row", "v"); err != ErrStaleToken {
+		t.Fatal("data write with stale token must fail", err)
+	}
+	checkpoint := ""
+	helper.GetCheckpoint(&checkpoint)
+	if checkpoint != "cp1" {
+		t.Fatal("checkpoint is overwritten by stale token", checkpoint)
+	}
+}
+
+func TestUnfencedWriteRejected(t *testing.T) {
+	store := kv.NewMemory()
+	defer store.Close()
+	manager := NewManager("c1", "n1", store, &testFactory{})
+
+	helper, err := manager.newHelper("j1", JobSpec{Data: []byte("a"), Version: 1})
+	if err != nil || helper.FencingToken() != 0 {
+		t.Fatal("helper of job without fence", helper, err)
+	}
+	if err = helper.PutCheckpoint("cp1"); err != ErrNotFenced {
+		t.Fatal("write without fence must fail", err)
+	}
+
+	// the token is read again once the leader fenced the job
+	token := fenceJob(t, store, "j1", "n1")
+	if err = helper.PutCheckpoint("cp1"); err != nil {
+		t.Fatal(err)
+	}
+	if helper.FencingToken() != token {
+		t.Fatal("token is not refreshed", helper.FencingToken(), token)
+	}
+}
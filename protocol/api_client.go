@@ -2,9 +2,88 @@ package protocol
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"time"
 )
 
+// Status kernel status
+type Status struct {
+	ID       string    `json:"id"`
+	Cluster  string    `json:"cluster"`
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Since    time.Time `json:"since"`
+	Leader   bool      `json:"leader"`
+	Draining bool      `json:"draining"`
+	Paused   bool      `json:"paused"`
+	Workers  []string  `json:"workers"`
+}
+
+// Placement placement constraints of a job. SetPlacement keeps the pin of the job, pins are set with PinJob.
+type Placement struct {
+	RequiredLabels map[string]string `json:"requiredLabels,omitempty"`
+	AntiAffinity   string            `json:"antiAffinity,omitempty"`
+	PreferredZone  string            `json:"preferredZone,omitempty"`
+	PinnedTo       string            `json:"pinnedTo,omitempty"`
+}
+
+// Move a job moving between members
+type Move struct {
+	Job  string `json:"job"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Plan rebalance plan
+type Plan struct {
+	Moves       []Move              `json:"moves"`
+	Assignments map[string][]string `json:"assignments"`
+	Loads       map[string]int      `json:"loads"`
+	Unplaced    map[string]string   `json:"unplaced,omitempty"`
+}
+
+// JobStatus status of a job written by its owner
+type JobStatus struct {
+	State        string    `json:"state"`
+	Error        string    `json:"error,omitempty"`
+	Owner        string    `json:"owner,omitempty"`
+	StartedAt    time.Time `json:"startedAt,omitempty"`
+	RestartCount int       `json:"restartCount"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// ValidationError invalid job data, returned by the API with status 400
+type ValidationError struct {
+	Factory string `json:"factory"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (err *ValidationError) Error() string {
+	if err.Field == "" {
+		return "Invalid job for " + err.Factory + ": " + err.Message
+	}
+	return "Invalid job for " + err.Factory + ", " + err.Field + ": " + err.Message
+}
+
+// Job job with its metadata
+type Job struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Creator   string            `json:"creator,omitempty"`
+	Version   int64             `json:"version"`
+	Paused    bool              `json:"paused,omitempty"`
+	Data      string            `json:"data"`
+	Placement *Placement        `json:"placement,omitempty"`
+	Status    *JobStatus        `json:"status,omitempty"`
+}
+
 //Client API client
 type Client struct {
 	daemonURL string
@@ -42,3 +121,371 @@ func (client *Client) RemoveJob(jobid string) bool {
 	resp, err := http.Post(client.daemonURL+V1Path+RemoveJobPath, "text/json", &buffer)
 	return (err == nil && resp.StatusCode == 200)
 }
+
+// SetPlacement sets placement constraints of a job
+func (client *Client) SetPlacement(jobid string, placement Placement) (err error) {
+	data, err := json.Marshal(placement)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, client.daemonURL+V1Path+PlacementPath+jobid, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errors.New("SetPlacement failed : " + resp.Status)
+	}
+	return nil
+}
+
+// GetPlacement returns nil if the job has no placement constraints
+func (client *Client) GetPlacement(jobid string) (placement *Placement, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + PlacementPath + jobid)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New("GetPlacement failed : " + resp.Status)
+	}
+
+	placement = new(Placement)
+	err = json.NewDecoder(resp.Body).Decode(placement)
+	return placement, err
+}
+
+// Loads returns total weight of jobs assigned to each member
+func (client *Client) Loads() (loads map[string]int, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + LoadsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Loads failed : " + resp.Status)
+	}
+
+	loads = make(map[string]int)
+	err = json.NewDecoder(resp.Body).Decode(&loads)
+	return loads, err
+}
+
+// PlanRebalance returns the plan of the job organizer without applying it.
+// A full plan distributes all jobs again.
+func (client *Client) PlanRebalance(full bool) (plan *Plan, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + RebalancePlanPath + fullQuery(full))
+	if err != nil {
+		return nil, err
+	}
+	return decodePlan(resp, "PlanRebalance")
+}
+
+// ApplyPlan applies a plan on the leader
+func (client *Client) ApplyPlan(plan *Plan) (err error) {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(client.daemonURL+V1Path+RebalanceApplyPath, "text/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errors.New("ApplyPlan failed : " + resp.Status)
+	}
+	return nil
+}
+
+// Rebalance plans and applies on the leader, and returns the applied plan
+func (client *Client) Rebalance(full bool) (plan *Plan, err error) {
+	resp, err := http.Post(client.daemonURL+V1Path+RebalancePath+fullQuery(full), "text/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodePlan(resp, "Rebalance")
+}
+
+func fullQuery(full bool) string {
+	if full {
+		return "?full=true"
+	}
+	return ""
+}
+
+func decodePlan(resp *http.Response, name string) (plan *Plan, err error) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New(name + " failed : " + resp.Status)
+	}
+
+	plan = new(Plan)
+	err = json.NewDecoder(resp.Body).Decode(plan)
+	return plan, err
+}
+
+// Cordon : the member gets no new jobs, but keeps running its jobs
+func (client *Client) Cordon(membID string) (err error) {
+	return client.sendCordon(http.MethodPut, membID)
+}
+
+// Uncordon ..
+func (client *Client) Uncordon(membID string) (err error) {
+	return client.sendCordon(http.MethodDelete, membID)
+}
+
+// Cordons returns ids of cordoned members
+func (client *Client) Cordons() (ids []string, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + CordonPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Cordons failed : " + resp.Status)
+	}
+	ids = []string{}
+	err = json.NewDecoder(resp.Body).Decode(&ids)
+	return ids, err
+}
+
+// PinJob : the job runs on the member, regardless of other constraints and organizers
+func (client *Client) PinJob(jobid string, membID string) (err error) {
+	return client.sendPin(http.MethodPut, jobid+"/"+membID)
+}
+
+// UnpinJob ..
+func (client *Client) UnpinJob(jobid string) (err error) {
+	return client.sendPin(http.MethodDelete, jobid)
+}
+
+func (client *Client) sendPin(method string, path string) (err error) {
+	req, err := http.NewRequest(method, client.daemonURL+V1Path+PinPath+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errors.New(method + " pin failed : " + resp.Status)
+	}
+	return nil
+}
+
+func (client *Client) sendCordon(method string, membID string) (err error) {
+	req, err := http.NewRequest(method, client.daemonURL+V1Path+CordonPath+membID, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errors.New(method + " cordon failed : " + resp.Status)
+	}
+	return nil
+}
+
+// Drain moves jobs of the kernel to other members, and waits until its workers stop.
+// The kernel leaves the cluster when it is stopped.
+func (client *Client) Drain() (err error) {
+	resp, err := http.Post(client.daemonURL+V1Path+DrainPath, "text/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errors.New("Drain failed : " + resp.Status)
+	}
+	return nil
+}
+
+// CreateJob adds a job with name, labels, creator, data and placement of job, and returns the stored job
+func (client *Client) CreateJob(job Job) (created *Job, err error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Post(client.daemonURL+V1Path+JobsPath, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, readValidationError(resp, "CreateJob")
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New("CreateJob failed : " + resp.Status)
+	}
+	created = new(Job)
+	err = json.NewDecoder(resp.Body).Decode(created)
+	return created, err
+}
+
+// Jobs returns all jobs
+func (client *Client) Jobs() (jobs []Job, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + JobsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Jobs failed : " + resp.Status)
+	}
+	jobs = []Job{}
+	err = json.NewDecoder(resp.Body).Decode(&jobs)
+	return jobs, err
+}
+
+// JobsInState returns jobs in state, e.g. failed
+func (client *Client) JobsInState(state string) (jobs []Job, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + JobsPath + "?state=" + url.QueryEscape(state))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("JobsInState failed : " + resp.Status)
+	}
+	jobs = []Job{}
+	err = json.NewDecoder(resp.Body).Decode(&jobs)
+	return jobs, err
+}
+
+// UpdateJob replaces data, name and labels of the job with job.ID, and returns the updated job.
+// The worker of the job is restarted when data changes.
+func (client *Client) UpdateJob(job Job) (updated *Job, err error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPut, client.daemonURL+V1Path+JobsPath+job.ID, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, readValidationError(resp, "UpdateJob")
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New("UpdateJob failed : " + resp.Status)
+	}
+	updated = new(Job)
+	err = json.NewDecoder(resp.Body).Decode(updated)
+	return updated, err
+}
+
+// readValidationError returns *ValidationError in the response, or an error with the status
+func readValidationError(resp *http.Response, name string) error {
+	validationErr := new(ValidationError)
+	if err := json.NewDecoder(resp.Body).Decode(validationErr); err != nil || validationErr.Message == "" {
+		return errors.New(name + " failed : " + resp.Status)
+	}
+	return validationErr
+}
+
+// PauseJob stops the job keeping its definition, checkpoint and data, and returns the paused job
+func (client *Client) PauseJob(jobid string) (job *Job, err error) {
+	return client.postJob(jobid, PausePath)
+}
+
+// ResumeJob ..
+func (client *Client) ResumeJob(jobid string) (job *Job, err error) {
+	return client.postJob(jobid, ResumePath)
+}
+
+func (client *Client) postJob(jobid string, path string) (job *Job, err error) {
+	resp, err := http.Post(client.daemonURL+V1Path+JobsPath+jobid+path, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Job " + path[1:] + " failed : " + resp.Status)
+	}
+	job = new(Job)
+	err = json.NewDecoder(resp.Body).Decode(job)
+	return job, err
+}
+
+// JobStatus ..
+func (client *Client) JobStatus(jobid string) (status *JobStatus, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + JobsPath + jobid + StatusPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("JobStatus failed : " + resp.Status)
+	}
+	status = new(JobStatus)
+	err = json.NewDecoder(resp.Body).Decode(status)
+	return status, err
+}
+
+// GetJob ..
+func (client *Client) GetJob(jobid string) (job *Job, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + JobsPath + jobid)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("GetJob failed : " + resp.Status)
+	}
+	job = new(Job)
+	err = json.NewDecoder(resp.Body).Decode(job)
+	return job, err
+}
+
+// Status ..
+func (client *Client) Status() (status *Status, err error) {
+	resp, err := http.Get(client.daemonURL + V1Path + StatusPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Status failed : " + resp.Status)
+	}
+
+	status = new(Status)
+	err = json.NewDecoder(resp.Body).Decode(status)
+	return status, err
+}
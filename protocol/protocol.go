@@ -12,4 +12,40 @@ const (
 
 	// RemoveJobPath /removejob
 	RemoveJobPath = "/removejob"
+
+	// JobsPath /jobs?state=, /jobs/:id, /jobs/:id/status, /jobs/:id/pause, /jobs/:id/resume
+	JobsPath = "/jobs/"
+
+	// PausePath /jobs/:id/pause
+	PausePath = "/pause"
+
+	// ResumePath /jobs/:id/resume
+	ResumePath = "/resume"
+
+	// StatusPath /status
+	StatusPath = "/status"
+
+	// PlacementPath /placement/:id
+	PlacementPath = "/placement/"
+
+	// LoadsPath /loads
+	LoadsPath = "/loads"
+
+	// RebalancePath /rebalance
+	RebalancePath = "/rebalance"
+
+	// RebalancePlanPath /rebalance/plan
+	RebalancePlanPath = "/rebalance/plan"
+
+	// RebalanceApplyPath /rebalance/apply
+	RebalanceApplyPath = "/rebalance/apply"
+
+	// CordonPath /cordon/:id
+	CordonPath = "/cordon/"
+
+	// PinPath /pin/:id/:member, /pin/:id
+	PinPath = "/pin/"
+
+	// DrainPath /drain
+	DrainPath = "/drain"
 )
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/rhizomata/bridge-chain-etcd/protocol"
@@ -26,7 +29,66 @@ func main() {
 
 			// client.AddJob([]byte(`#eth_subs:{"handler":"erc20","cas":[
 			// 	"0xdac17f958d2ee523a2206206994597c13d831ec7"]}`))
+		} else if args[0] == "plan" {
+			// plan [full] : print rebalance plan
+			plan, err := client.PlanRebalance(len(args) > 1 && args[1] == "full")
+			printPlan(plan, err)
+		} else if args[0] == "apply" {
+			// apply <plan.json> : apply a plan printed by plan
+			data, err := ioutil.ReadFile(args[1])
+			if err != nil {
+				fmt.Println("Cannot read plan", err)
+				os.Exit(1)
+			}
+			plan := new(protocol.Plan)
+			err = json.Unmarshal(data, plan)
+			if err == nil {
+				err = client.ApplyPlan(plan)
+			}
+			printPlan(plan, err)
+		} else if args[0] == "rebalance" {
+			// rebalance [full] : plan and apply
+			plan, err := client.Rebalance(len(args) > 1 && args[1] == "full")
+			printPlan(plan, err)
+		} else if args[0] == "pause" || args[0] == "resume" {
+			// pause <jobid>, resume <jobid>
+			var j *protocol.Job
+			var err error
+			if args[0] == "pause" {
+				j, err = client.PauseJob(args[1])
+			} else {
+				j, err = client.ResumeJob(args[1])
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println(j.ID, "paused:", j.Paused)
+		} else if args[0] == "jobs" {
+			// jobs [state] : print jobs with their status, e.g. jobs failed
+			var jobs []protocol.Job
+			var err error
+			if len(args) > 1 {
+				jobs, err = client.JobsInState(args[1])
+			} else {
+				jobs, err = client.Jobs()
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			data, _ := json.MarshalIndent(jobs, "", "  ")
+			fmt.Println(string(data))
 		}
 	}
 
 }
+
+func printPlan(plan *protocol.Plan, err error) {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	data, _ := json.MarshalIndent(plan, "", "  ")
+	fmt.Println(string(data))
+}